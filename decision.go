@@ -0,0 +1,90 @@
+package security
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
+)
+
+// 自定义参数来源
+const ParamSourceCustom = "custom"
+
+// 检查结果
+//
+// 由 Guard.Decide / Sentinel.Decide / Sentinel.StrictDecide 返回，描述是哪条规则做出了决定
+type Decision struct {
+	// 是否放行
+	Allowed bool
+
+	// 端点是否命中规则，未命中时结果由默认策略或 UnmatchedHandler 决定
+	Matched bool
+
+	// 命中的端点路径表达式，Guard.Decide 时为空
+	Pattern string
+
+	// 命中规则的请求方法，规则不限方法时为空
+	Method string
+
+	// 策略 allow / deny ; 端点未命中规则时为默认策略 (使用 UnmatchedHandler 时为空)
+	Policy string
+
+	// 原始表达式
+	Express string
+
+	// 参与计算的参数
+	Params []DecisionParam
+
+	// 检查耗时
+	Duration time.Duration
+}
+
+// 参与计算的参数
+type DecisionParam struct {
+	// 参数来源 path / query / wildcard / custom , 直接传入 Guard 的参数为空
+	Source string
+	// 参数名
+	Name string
+	// 参数值
+	Value any
+}
+
+// 收集参数及其来源
+//
+// 带来源的参数只保留 "来源.参数名" 一份，不带来源的同名参数不再重复记录
+func decisionParams(params map[string]any, customParams map[string]string, customValues map[string]any) []DecisionParam {
+	result := []DecisionParam{}
+	sourced := map[string]bool{}
+	for k, v := range params {
+		source, name, ok := strings.Cut(k, ".")
+		if ok && ctx.IsParamSource(source) {
+			sourced[name] = true
+			result = append(result, DecisionParam{Source: source, Name: name, Value: v})
+		}
+	}
+	for k, v := range params {
+		source, _, ok := strings.Cut(k, ".")
+		if ok && ctx.IsParamSource(source) || sourced[k] {
+			continue
+		}
+		result = append(result, DecisionParam{Name: k, Value: v})
+	}
+	for k, v := range customParams {
+		if _, ok := customValues[k]; ok {
+			continue
+		}
+		result = append(result, DecisionParam{Source: ParamSourceCustom, Name: k, Value: v})
+	}
+	for k, v := range customValues {
+		result = append(result, DecisionParam{Source: ParamSourceCustom, Name: k, Value: v})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Source != result[j].Source {
+			return result[i].Source < result[j].Source
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
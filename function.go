@@ -0,0 +1,68 @@
+package security
+
+import (
+	"fmt"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+	"github.com/einsitang/go-security/internal/expr/snytax/function"
+)
+
+// 函数参数 / 返回值类型，可用 | 组合多种类型
+type ValueType int
+
+const (
+	TypeBool   ValueType = syntax.Type_Bool
+	TypeNumber ValueType = syntax.Type_Number
+	TypeString ValueType = syntax.Type_String
+	TypeNull   ValueType = syntax.Type_Null
+	// time.Time
+	TypeTime ValueType = syntax.Type_Time
+	// time.Duration
+	TypeDuration ValueType = syntax.Type_Duration
+	// 任意类型(含 null)
+	TypeAny = TypeBool | TypeNumber | TypeString | TypeNull | TypeTime | TypeDuration
+)
+
+// 函数签名
+type Signature struct {
+	// 每个参数接受的类型
+	Args []ValueType
+	// 返回值类型
+	Return ValueType
+}
+
+// 自定义函数实现
+//
+// args 为参数求值结果，参数个数与类型已在解析时检查；
+// 参数可能来自 $ / # 参数，运行时的实际类型需要自行检查(Check 传入的 # 参数总是字符串)
+//
+// 返回值类型必须符合 Signature.Return , 否则检查返回错误
+type FunctionImpl func(context *SecurityContext, args []any) (any, error)
+
+// 创建函数定义
+func newFunction(name string, signature Signature, impl FunctionImpl) (*function.Func, error) {
+	if impl == nil {
+		return nil, fmt.Errorf("function %s: impl is nil", name)
+	}
+	if signature.Return&TypeAny == 0 || signature.Return&^TypeAny != 0 {
+		return nil, fmt.Errorf("function %s: invalid return type", name)
+	}
+
+	args := make([]int, len(signature.Args))
+	for i, arg := range signature.Args {
+		if arg&TypeAny == 0 || arg&^TypeAny != 0 {
+			return nil, fmt.Errorf("function %s: invalid type of argument %d", name, i+1)
+		}
+		args[i] = int(arg)
+	}
+
+	return &function.Func{
+		Name:   name,
+		Args:   args,
+		Return: int(signature.Return),
+		Impl: func(c *ctx.Context, args []any) (any, error) {
+			return impl((*SecurityContext)(c), args)
+		},
+	}, nil
+}
@@ -1,15 +1,37 @@
 package security
 
 import (
-	"log"
-	"reflect"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/einsitang/go-security/internal/expr"
 	"github.com/einsitang/go-security/internal/expr/ctx"
 	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+	"github.com/einsitang/go-security/internal/expr/snytax/function"
+	"github.com/einsitang/go-security/internal/expr/snytax/oper"
+	"github.com/einsitang/go-security/internal/expr/snytax/value"
+	"github.com/einsitang/go-security/internal/parse"
 )
 
-var analyzer = expr.NewAnalyzer()
+var analyzer expr.SyntaxAnalyzer = expr.NewAnalyzer()
+
+// 运行时错误，Check 返回的错误可用 errors.Is 判断
+var (
+	// 除数为 0，如 $a / 0 、 $a % 0
+	ErrDivisionByZero = oper.ErrDivisionByZero
+	// 整数运算结果超出 int64 范围，或浮点运算结果为无穷大
+	ErrNumericOverflow = oper.ErrOverflow
+	// 严格类型模式下比较的两侧类型不同
+	ErrTypeMismatch = oper.ErrTypeMismatch
+	// 开启 WithMissingParamError / WithGuardMissingParamError 时引用了不存在的参数
+	ErrMissingParam = value.ErrMissingParam
+	// 数值运算 / 大小比较的操作数为 null(如参数不存在)，不按 0 处理
+	ErrNullOperand = oper.ErrNullOperand
+	// 表达式的结果不是布尔值，如 allow: $flag 中参数 flag 的值为字符串
+	ErrNonBoolean = errors.New("expression does not return a bool value")
+)
 
 type Guard interface {
 	// 返回原始表达式
@@ -19,6 +41,42 @@ type Guard interface {
 	//
 	// 通过 true / 失败 false , 错误则 err 非 nil, 此时不考虑 bool 值
 	Check(context *SecurityContext) (bool, error)
+
+	// 权限检查，返回详细的检查结果 Decision
+	//
+	// 错误则 err 非 nil, 此时 Decision 仍包含策略、表达式等信息，但不考虑 Allowed 值
+	Decide(context *SecurityContext) (*Decision, error)
+
+	// 解释表达式的求值过程，记录每个节点的位置、操作符和求值结果
+	//
+	// 每个节点都会单独求值，仅用于调试
+	Explain(context *SecurityContext) (*Explanation, error)
+
+	// 创建时类型检查的警告，如永远不会成立的比较 $a > 'abc'
+	Warnings() []*ParseError
+}
+
+// 节点求值轨迹
+type Trace = expr.Trace
+
+// 表达式求值过程
+type Explanation struct {
+	// 原始表达式
+	Express string
+	// 策略 allow / deny
+	Policy string
+	// 最终结果(已按策略处理)
+	Allowed bool
+	// 根节点求值轨迹
+	Trace *Trace
+}
+
+// 返回标注了中间结果的表达式
+func (e *Explanation) String() string {
+	if e.Trace == nil {
+		return e.Express
+	}
+	return fmt.Sprintf("%s=> %s: %v\n", e.Trace.Render(e.Express), e.Policy, e.Allowed)
 }
 
 type guard struct {
@@ -30,16 +88,51 @@ func (g *guard) Express() string {
 	return g.express
 }
 
+func (g *guard) Warnings() []*ParseError {
+	return g.syntaxTree.Warnings
+}
+
 func (g *guard) Check(context *SecurityContext) (bool, error) {
+	return g.evaluate(context)
+}
+
+func (g *guard) Decide(context *SecurityContext) (*Decision, error) {
+	start := time.Now()
+	allowed, err := g.evaluate(context)
+	return &Decision{
+		Allowed:  allowed,
+		Matched:  true,
+		Policy:   g.syntaxTree.Policy,
+		Express:  g.express,
+		Params:   decisionParams(context.Params, context.CustomParams, context.CustomValues),
+		Duration: time.Since(start),
+	}, err
+}
+
+func (g *guard) Explain(context *SecurityContext) (*Explanation, error) {
+	allowed, err := g.evaluate(context)
+	return &Explanation{
+		Express: g.express,
+		Policy:  g.syntaxTree.Policy,
+		Allowed: allowed,
+		Trace:   g.syntaxTree.Explain((*ctx.Context)(context)),
+	}, err
+}
+
+func (g *guard) evaluate(context *SecurityContext) (bool, error) {
 	st := g.syntaxTree
+	if st.Syntax == nil {
+		// 只有策略，如 allow
+		return st.Policy == "allow", nil
+	}
 	eval := st.Syntax.Evaluate((*ctx.Context)(context))
 	if eval.IsError {
 		return false, eval.Error
 	}
 
+	// 参数等动态类型的结果在创建时无法确定
 	if eval.Type != syntax.Type_Bool {
-		log.Printf("[warnning] evaluate return value not type bool , result.type:%v , result.value:%v \n", reflect.TypeOf(eval.Type).String(), eval.Value)
-		return false, nil
+		return false, fmt.Errorf("%w: \"%v\"", ErrNonBoolean, eval.Value)
 	}
 
 	checked := eval.Value.(bool)
@@ -50,13 +143,143 @@ func (g *guard) Check(context *SecurityContext) (bool, error) {
 	return !checked, nil
 }
 
-func NewGuard(express string) (Guard, error) {
-	st, err := analyzer.Parse(express)
+func NewGuard(express string, options ...GuardOption) (Guard, error) {
+	opts := &guardOptions{analyzer: analyzer}
+	for _, option := range options {
+		if err := option(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	_analyzer := opts.analyzer
+	if opts.wildcardPermission {
+		_analyzer = _analyzer.WithWildcardPermission()
+	}
+	if opts.roleHierarchy != nil {
+		_analyzer = _analyzer.WithRoleHierarchy(opts.roleHierarchy)
+	}
+	if opts.decimal {
+		_analyzer = _analyzer.WithDecimal()
+	}
+	if opts.strictTypes {
+		_analyzer = _analyzer.WithStrictTypes()
+	}
+	if opts.missingParamError {
+		_analyzer = _analyzer.WithMissingParamError()
+	}
+	if len(opts.functions) > 0 {
+		var err error
+		if _analyzer, err = _analyzer.WithFunctions(opts.functions...); err != nil {
+			return nil, err
+		}
+	}
+
+	st, err := _analyzer.Parse(express)
 	if err != nil {
 		return nil, err
 	}
+	if errs := st.Check(opts.definedParam); len(errs) > 0 {
+		return nil, errs
+	}
 	return &guard{
 		express:    express,
 		syntaxTree: st,
 	}, nil
 }
+
+type guardOptions struct {
+	analyzer           expr.SyntaxAnalyzer
+	functions          []*function.Func
+	wildcardPermission bool
+	roleHierarchy      *RoleHierarchy
+	decimal            bool
+	strictTypes        bool
+	missingParamError  bool
+	// 非 nil 时检查 $ 参数是否由端点提供
+	definedParam func(name string) bool
+}
+
+type GuardOption func(o *guardOptions) error
+
+// 注册自定义函数，仅对当前 Guard 生效
+//
+// name 不能与关键字、内置函数重名
+func WithGuardFunction(name string, signature Signature, impl FunctionImpl) GuardOption {
+	return func(o *guardOptions) error {
+		fn, err := newFunction(name, signature, impl)
+		if err != nil {
+			return err
+		}
+		o.functions = append(o.functions, fn)
+		return nil
+	}
+}
+
+// Permission / Permissions 按通配符权限(domain:action:instance)匹配
+//
+// 匹配规则见 PermissionImplies
+func WithGuardWildcardPermission() GuardOption {
+	return func(o *guardOptions) error {
+		o.wildcardPermission = true
+		return nil
+	}
+}
+
+// Role / Roles 按角色继承匹配
+func WithGuardRoleHierarchy(hierarchy *RoleHierarchy) GuardOption {
+	return func(o *guardOptions) error {
+		o.roleHierarchy = hierarchy
+		return nil
+	}
+}
+
+// 数值运算 / 比较按十进制精确计算，适用于金额等场景
+//
+// 如 0.1 + 0.2 == 0.3 成立，整数除法不再取整
+func WithGuardDecimal() GuardOption {
+	return func(o *guardOptions) error {
+		o.decimal = true
+		return nil
+	}
+}
+
+// 比较两侧类型不同时 Check 返回 ErrTypeMismatch ，而不是按规则转换后比较
+//
+// 如路径参数 $id 为 '1' 时 $id == 1 默认为 true ，开启后返回 ErrTypeMismatch ；与 null 比较不受影响
+func WithGuardStrictTypes() GuardOption {
+	return func(o *guardOptions) error {
+		o.strictTypes = true
+		return nil
+	}
+}
+
+// 引用不存在的 $ / # 参数时 Check 返回 ErrMissingParam ，而不是按 null 处理
+//
+// exists($x) / has(#x) / $x ?? 'default' 不受影响
+func WithGuardMissingParamError() GuardOption {
+	return func(o *guardOptions) error {
+		o.missingParamError = true
+		return nil
+	}
+}
+
+// 检查 $ 参数是否都由端点提供(Sentinel 内部使用)
+//
+// 未在端点中声明的查询参数需要通过 $query.name 访问
+func withEndpoint(endpoint string) GuardOption {
+	params := parse.PatternParams(endpoint)
+	return func(o *guardOptions) error {
+		o.definedParam = func(name string) bool {
+			return params[name] || strings.HasPrefix(name, ctx.ParamSourceQuery+".")
+		}
+		return nil
+	}
+}
+
+// 使用指定的解析器(Sentinel 内部使用)
+func withAnalyzer(a expr.SyntaxAnalyzer) GuardOption {
+	return func(o *guardOptions) error {
+		o.analyzer = a
+		return nil
+	}
+}
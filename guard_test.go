@@ -1,8 +1,12 @@
 package security
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 // Test principal implementation for testing
@@ -29,6 +33,16 @@ func (p *testPrincipal) Groups() []string {
 	return p.groups
 }
 
+// Test principal with attributes
+type attributedTestPrincipal struct {
+	testPrincipal
+	attributes map[string]any
+}
+
+func (p *attributedTestPrincipal) Attributes() map[string]any {
+	return p.attributes
+}
+
 func TestGuard_NewGuard(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -365,6 +379,24 @@ func TestGuard_ParameterCheck(t *testing.T) {
 			},
 			expected: true,
 		},
+		{
+			name:     "Wildcard parameter",
+			express:  "allow: $0 == 'public' and $wildcard.0 == 'public'",
+			params:   map[string]any{"0": "public", "wildcard.0": "public"},
+			expected: true,
+		},
+		{
+			name:     "Wildcard parameter - legacy key",
+			express:  "allow: $0 == 'public' and $1 == 'doc.pdf'",
+			params:   map[string]any{"$0": "public", "$1": "doc.pdf"},
+			expected: true,
+		},
+		{
+			name:     "Wildcard parameter - new key wins",
+			express:  "allow: $0 == 'public'",
+			params:   map[string]any{"0": "public", "$0": "secret"},
+			expected: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -568,6 +600,191 @@ func TestGuard_MathematicalOperations(t *testing.T) {
 	}
 }
 
+func TestGuard_NumericPrecision(t *testing.T) {
+	tests := []struct {
+		name     string
+		express  string
+		options  []GuardOption
+		params   map[string]any
+		expected bool
+		err      error
+	}{
+		{
+			name:     "Large int64 is exact",
+			express:  "allow: $id == 9007199254740993",
+			params:   map[string]any{"id": int64(9007199254740993)},
+			expected: true,
+		},
+		{
+			name:     "Large int64 comparison",
+			express:  "allow: $id > 9007199254740992",
+			params:   map[string]any{"id": "9007199254740993"},
+			expected: true,
+		},
+		{
+			name:     "Large int64 addition",
+			express:  "allow: $id + 1 == 9007199254740994",
+			params:   map[string]any{"id": int64(9007199254740993)},
+			expected: true,
+		},
+		{
+			name:     "Integer and float",
+			express:  "allow: $requested <= $available * 0.8",
+			params:   map[string]any{"requested": 80, "available": 100},
+			expected: true,
+		},
+		{
+			name:     "Integer and float - exceeded",
+			express:  "allow: $requested <= $available * 0.8",
+			params:   map[string]any{"requested": 81, "available": 100},
+			expected: false,
+		},
+		{
+			name:     "Float64 precision",
+			express:  "allow: $amount == 16777217.5",
+			params:   map[string]any{"amount": 16777217.5},
+			expected: true,
+		},
+		{
+			name:     "Integer equals float",
+			express:  "allow: $count == 2.0",
+			params:   map[string]any{"count": 2},
+			expected: true,
+		},
+		{
+			name:     "Uint param",
+			express:  "allow: $size < 10",
+			params:   map[string]any{"size": uint8(3)},
+			expected: true,
+		},
+		{
+			name:     "Integer division truncates",
+			express:  "allow: $a / 2 == 3",
+			params:   map[string]any{"a": 7},
+			expected: true,
+		},
+		{
+			name:     "Binary float without decimal",
+			express:  "allow: $a + $b == 0.3",
+			params:   map[string]any{"a": 0.1, "b": 0.2},
+			expected: false,
+		},
+		{
+			name:     "Decimal mode",
+			express:  "allow: $a + $b == 0.3",
+			options:  []GuardOption{WithGuardDecimal()},
+			params:   map[string]any{"a": 0.1, "b": 0.2},
+			expected: true,
+		},
+		{
+			name:     "Decimal mode - string amount",
+			express:  "allow: $balance - $price >= 0.01",
+			options:  []GuardOption{WithGuardDecimal()},
+			params:   map[string]any{"balance": "10.11", "price": "10.10"},
+			expected: true,
+		},
+		{
+			name:     "Decimal mode - exact division",
+			express:  "allow: $a / 2 == 3.5",
+			options:  []GuardOption{WithGuardDecimal()},
+			params:   map[string]any{"a": 7},
+			expected: true,
+		},
+		{
+			name:    "Division by zero",
+			express: "allow: $a / $b > 1",
+			params:  map[string]any{"a": 1, "b": 0},
+			err:     ErrDivisionByZero,
+		},
+		{
+			name:    "Float division by zero",
+			express: "allow: $a / $b > 1",
+			params:  map[string]any{"a": 1.5, "b": 0.0},
+			err:     ErrDivisionByZero,
+		},
+		{
+			name:    "Modulo by zero",
+			express: "allow: $a % $b == 0",
+			params:  map[string]any{"a": 1, "b": 0},
+			err:     ErrDivisionByZero,
+		},
+		{
+			name:    "Decimal division by zero",
+			express: "allow: $a / $b > 1",
+			options: []GuardOption{WithGuardDecimal()},
+			params:  map[string]any{"a": "1.5", "b": "0"},
+			err:     ErrDivisionByZero,
+		},
+		{
+			name:    "Integer overflow",
+			express: "allow: $a + 1 > 0",
+			params:  map[string]any{"a": int64(9223372036854775807)},
+			err:     ErrNumericOverflow,
+		},
+		{
+			name:    "Multiplication overflow",
+			express: "allow: $a * $a > 0",
+			params:  map[string]any{"a": int64(4294967296)},
+			err:     ErrNumericOverflow,
+		},
+		{
+			name:    "Uint64 overflow",
+			express: "allow: $a > 0",
+			params:  map[string]any{"a": uint64(18446744073709551615)},
+			err:     ErrNumericOverflow,
+		},
+		{
+			name:    "Float overflow",
+			express: "allow: $a * $a > 0",
+			params:  map[string]any{"a": 1e200},
+			err:     ErrNumericOverflow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express, tt.options...)
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+
+			result, err := guard.Check(&SecurityContext{
+				Params: tt.params,
+			})
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("Expected error %v, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("Float modulo", func(t *testing.T) {
+		guard, err := NewGuard("allow: $a % 2 == 1")
+		if err != nil {
+			t.Fatalf("Failed to create guard: %v", err)
+		}
+		if _, err := guard.Check(&SecurityContext{Params: map[string]any{"a": 3.5}}); err == nil {
+			t.Error("Expected error for float modulo")
+		}
+	})
+
+	t.Run("Integer literal out of range", func(t *testing.T) {
+		_, err := NewGuard("allow: $a > 9223372036854775808")
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Code != CodeInvalidLiteral {
+			t.Errorf("Expected %s, got %v", CodeInvalidLiteral, err)
+		}
+	})
+}
+
 func TestGuard_ComparisonOperators(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -646,94 +863,2324 @@ func TestGuard_ComparisonOperators(t *testing.T) {
 	}
 }
 
-func TestGuard_EdgeCases(t *testing.T) {
+func TestGuard_Equality(t *testing.T) {
 	tests := []struct {
-		name      string
-		express   string
-		principal *testPrincipal
-		params    map[string]any
-		custom    map[string]string
-		expected  bool
-		wantError bool
+		name     string
+		express  string
+		options  []GuardOption
+		params   map[string]any
+		expected bool
+		err      error
 	}{
+		{name: "Number and numeric string", express: "allow: $id == 1", params: map[string]any{"id": "1"}, expected: true},
+		{name: "Number and formatted string", express: "allow: $price == '1.50'", params: map[string]any{"price": 1.5}, expected: true},
+		{name: "Integer and float", express: "allow: $count == 2.0", params: map[string]any{"count": 2}, expected: true},
+		{name: "Number and non-numeric string", express: "allow: $id != 1", params: map[string]any{"id": "one"}, expected: true},
+		{name: "Strings compare as is", express: "allow: $price == '1.5'", params: map[string]any{"price": "1.50"}, expected: false},
+		{name: "Null is not empty string", express: "allow: $tenant == ''", params: map[string]any{}, expected: false},
+		{name: "Null equals null", express: "allow: $tenant == null", params: map[string]any{}, expected: true},
+		{name: "Bool and string", express: "allow: $flag == true", params: map[string]any{"flag": "true"}, expected: true},
+		{name: "Bool and number", express: "allow: $flag != true", params: map[string]any{"flag": 1}, expected: true},
 		{
-			name:    "Empty roles array",
-			express: "allow: Role('admin')",
-			principal: &testPrincipal{
-				roles: []string{},
-			},
-			expected: false,
+			name:     "Strict - same types",
+			express:  "allow: $id == 1 and $name == 'a' and $flag == true",
+			options:  []GuardOption{WithGuardStrictTypes()},
+			params:   map[string]any{"id": int64(1), "name": "a", "flag": true},
+			expected: true,
 		},
 		{
-			name:      "Nil principal",
-			express:   "allow: Role('admin')",
-			principal: nil,
-			wantError: true,
+			name:     "Strict - integer and float",
+			express:  "allow: $count == 2.0",
+			options:  []GuardOption{WithGuardStrictTypes()},
+			params:   map[string]any{"count": 2},
+			expected: true,
 		},
 		{
-			name:     "Missing parameter",
-			express:  "allow: $nonexistent == 'value'",
-			params:   map[string]any{},
-			expected: false,
+			name:     "Strict - null",
+			express:  "allow: $tenant == null and $name != null",
+			options:  []GuardOption{WithGuardStrictTypes()},
+			params:   map[string]any{"name": "a"},
+			expected: true,
 		},
 		{
-			name:    "Type mismatch in comparison",
-			express: "allow: $stringParam > 10",
-			params: map[string]any{
-				"stringParam": "hello",
-			},
-			wantError: true,
+			name:    "Strict - number and string",
+			express: "allow: $id == 1",
+			options: []GuardOption{WithGuardStrictTypes()},
+			params:  map[string]any{"id": "1"},
+			err:     ErrTypeMismatch,
 		},
 		{
-			name:     "Always true expression",
-			express:  "allow: 1 == 1",
+			name:    "Strict - not equal",
+			express: "allow: $flag != 'true'",
+			options: []GuardOption{WithGuardStrictTypes()},
+			params:  map[string]any{"flag": true},
+			err:     ErrTypeMismatch,
+		},
+		{
+			name:    "Strict - relational",
+			express: "allow: $age >= 18",
+			options: []GuardOption{WithGuardStrictTypes()},
+			params:  map[string]any{"age": "20"},
+			err:     ErrTypeMismatch,
+		},
+		// in / not in 与 == 的规则相同
+		{name: "in - integer and float", express: "allow: $a in [1.0, 2.0]", params: map[string]any{"a": 1}, expected: true},
+		{name: "in - number and formatted string", express: "allow: $a in ['1.0'] and $b in [1.5]", params: map[string]any{"a": 1, "b": "1.50"}, expected: true},
+		{name: "in - float item", express: "allow: $price in [0.5, 1.5]", params: map[string]any{"price": float32(1.5)}, expected: true},
+		{name: "in - strings compare as is", express: "allow: $price not in ['1.5']", params: map[string]any{"price": "1.50"}, expected: true},
+		{name: "in - non-numeric string", express: "allow: $id not in [1, 2]", params: map[string]any{"id": "one"}, expected: true},
+		{name: "in - bool and number", express: "allow: $flag not in [1]", params: map[string]any{"flag": true}, expected: true},
+		{name: "in - decimal", express: "allow: $a + 0.2 in [0.3]", options: []GuardOption{WithGuardDecimal()}, params: map[string]any{"a": 0.1}, expected: true},
+		{
+			name:     "Strict in - same types",
+			express:  "allow: $id in [1, 2] and $name not in ['b']",
+			options:  []GuardOption{WithGuardStrictTypes()},
+			params:   map[string]any{"id": 2, "name": "a"},
 			expected: true,
 		},
 		{
-			name:     "Always false expression",
-			express:  "allow: 1 == 2",
-			expected: false,
+			name:    "Strict in - number and string",
+			express: "allow: $id in [1, 2]",
+			options: []GuardOption{WithGuardStrictTypes()},
+			params:  map[string]any{"id": "1"},
+			err:     ErrTypeMismatch,
+		},
+		{
+			name:    "Strict not in - number and string",
+			express: "allow: $id not in ['1']",
+			options: []GuardOption{WithGuardStrictTypes()},
+			params:  map[string]any{"id": 1},
+			err:     ErrTypeMismatch,
+		},
+		{name: "contains - number and string", express: "allow: contains($tags, 1)", params: map[string]any{"tags": []string{"1", "2"}}, expected: true},
+		{
+			name:     "Strict contains - same types",
+			express:  "allow: contains($tags, '2')",
+			options:  []GuardOption{WithGuardStrictTypes()},
+			params:   map[string]any{"tags": []string{"1", "2"}},
+			expected: true,
+		},
+		{
+			name:    "Strict contains - number and string",
+			express: "allow: contains($tags, 1)",
+			options: []GuardOption{WithGuardStrictTypes()},
+			params:  map[string]any{"tags": []string{"1", "2"}},
+			err:     ErrTypeMismatch,
+		},
+		{
+			name:     "Decimal contains",
+			express:  "allow: contains($prices, 0.1 + 0.2)",
+			options:  []GuardOption{WithGuardDecimal()},
+			params:   map[string]any{"prices": []any{"0.3"}},
+			expected: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			guard, err := NewGuard(tt.express)
+			guard, err := NewGuard(tt.express, tt.options...)
 			if err != nil {
-				if !tt.wantError {
-					t.Fatalf("Failed to create guard: %v", err)
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+
+			result, err := guard.Check(&SecurityContext{
+				Params: tt.params,
+			})
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("Expected error %v, got %v", tt.err, err)
 				}
 				return
 			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
 
-			var result bool
-			var checkErr error
+func TestGuard_MissingParams(t *testing.T) {
+	tests := []struct {
+		name         string
+		express      string
+		options      []GuardOption
+		params       map[string]any
+		customParams map[string]string
+		expected     bool
+		err          error
+	}{
+		{name: "exists - present", express: "allow: exists($a)", params: map[string]any{"a": 1}, expected: true},
+		{name: "exists - absent", express: "allow: !exists($a)", params: map[string]any{}, expected: true},
+		{name: "exists - null value", express: "allow: exists($a) and $a == null", params: map[string]any{"a": nil}, expected: true},
+		{name: "exists - empty is not missing", express: "allow: exists($a) and $a == ''", params: map[string]any{"a": ""}, expected: true},
+		{
+			name:     "exists - missing path",
+			express:  "allow: exists($order.customer) and !exists($order.customer.id)",
+			params:   map[string]any{"order": map[string]any{"customer": map[string]any{}}},
+			expected: true,
+		},
+		{name: "has - present", express: "allow: has(#tenant)", customParams: map[string]string{"tenant": "t1"}, expected: true},
+		{name: "has - absent", express: "allow: has(#tenant)", customParams: map[string]string{}, expected: false},
+		{name: "Coalesce - absent", express: "allow: $region ?? 'cn' == 'cn'", params: map[string]any{}, expected: true},
+		{name: "Coalesce - null", express: "allow: $region ?? 'cn' == 'cn'", params: map[string]any{"region": nil}, expected: true},
+		{name: "Coalesce - present", express: "allow: $region ?? 'cn' == 'cn'", params: map[string]any{"region": "us"}, expected: false},
+		{name: "Coalesce - empty is not null", express: "allow: $region ?? 'cn' == ''", params: map[string]any{"region": ""}, expected: true},
+		{name: "Coalesce - number", express: "allow: $limit ?? 10 > 5", params: map[string]any{}, expected: true},
+		{
+			name:     "Coalesce - missing path",
+			express:  "allow: $order.customer.id ?? 0 == 0",
+			params:   map[string]any{"order": map[string]any{}},
+			expected: true,
+		},
+		{name: "Coalesce - chain", express: "allow: #a ?? #b ?? 'x' == 'b'", customParams: map[string]string{"b": "b"}, expected: true},
+		{name: "Null operand - relational", express: "allow: $quota < 10", params: map[string]any{}, err: ErrNullOperand},
+		{name: "Null operand - relational right", express: "allow: 10 >= $quota", params: map[string]any{"quota": nil}, err: ErrNullOperand},
+		{name: "Null operand - arithmetic", express: "allow: $used + 1 <= 10", params: map[string]any{}, err: ErrNullOperand},
+		{name: "Null operand - missing path", express: "allow: $order.total * 2 > 100", params: map[string]any{"order": map[string]any{"total": nil}}, err: ErrNullOperand},
+		{name: "Null operand - time", express: "allow: now() - $since > duration('1h')", params: map[string]any{}, err: ErrNullOperand},
+		{name: "Null operand - default", express: "allow: $quota ?? 0 < 10 and ($used ?? 0) + 1 <= 10", params: map[string]any{}, expected: true},
+		{name: "Null operand - equality unaffected", express: "allow: $quota != 0", params: map[string]any{}, expected: true},
+		{name: "Non-bool result - bool param", express: "allow: $flag", params: map[string]any{"flag": true}, expected: true},
+		{name: "Non-bool result - string", express: "allow: #flag", customParams: map[string]string{"flag": "true"}, err: ErrNonBoolean},
+		{name: "Non-bool result - null", express: "deny: $flag", params: map[string]any{}, err: ErrNonBoolean},
+		{
+			name:    "Missing param error",
+			express: "allow: $a == null",
+			options: []GuardOption{WithGuardMissingParamError()},
+			params:  map[string]any{},
+			err:     ErrMissingParam,
+		},
+		{
+			name:    "Missing param error - custom param",
+			express: "allow: #tenant == 't1'",
+			options: []GuardOption{WithGuardMissingParamError()},
+			err:     ErrMissingParam,
+		},
+		{
+			name:     "Missing param error - null value",
+			express:  "allow: $a == null",
+			options:  []GuardOption{WithGuardMissingParamError()},
+			params:   map[string]any{"a": nil},
+			expected: true,
+		},
+		{
+			name:     "Missing param error - exists and coalesce",
+			express:  "allow: !exists($a) and !has(#b) and $a ?? 1 == 1",
+			options:  []GuardOption{WithGuardMissingParamError()},
+			params:   map[string]any{},
+			expected: true,
+		},
+	}
 
-			// Handle potential panic from nil principal
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						checkErr = fmt.Errorf("panic occurred: %v", r)
-					}
-				}()
-				result, checkErr = guard.Check(&SecurityContext{
-					Principal:    tt.principal,
-					Params:       tt.params,
-					CustomParams: tt.custom,
-				})
-			}()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express, tt.options...)
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
 
-			if tt.wantError {
-				if checkErr == nil {
-					t.Error("Expected error but got none")
-				}
-			} else {
-				if checkErr != nil {
-					t.Errorf("Unexpected error: %v", checkErr)
-				}
-				if result != tt.expected {
-					t.Errorf("Expected %v, got %v", tt.expected, result)
+			result, err := guard.Check(&SecurityContext{
+				Params:       tt.params,
+				CustomParams: tt.customParams,
+			})
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("Expected error %v, got %v", tt.err, err)
 				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	for _, express := range []string{
+		"allow: exists(#a)",
+		"allow: has($a)",
+		"allow: exists('a')",
+		"allow: exists($a, $b)",
+		"allow: exists()",
+	} {
+		t.Run(express, func(t *testing.T) {
+			_, err := NewGuard(express)
+			var pe *ParseError
+			if !errors.As(err, &pe) || pe.Code != CodeInvalidArgument {
+				t.Errorf("Expected %s, got %v", CodeInvalidArgument, err)
+			}
+		})
+	}
+}
+
+func TestGuard_Quantifiers(t *testing.T) {
+	orders := []map[string]any{
+		{"status": "open", "amount": 10},
+		{"status": "closed", "amount": 200},
+	}
+	tests := []struct {
+		name     string
+		express  string
+		params   map[string]any
+		expected bool
+	}{
+		{name: "any - matched", express: "allow: any($tag, t -> t == 'public')", params: map[string]any{"tag": []string{"draft", "public"}}, expected: true},
+		{name: "any - not matched", express: "allow: any($tag, t -> t == 'public')", params: map[string]any{"tag": []string{"draft", "secret"}}, expected: false},
+		{name: "all - matched", express: "allow: all($tag, t -> t != 'secret')", params: map[string]any{"tag": []string{"draft", "public"}}, expected: true},
+		{name: "all - not matched", express: "allow: all($tag, t -> t != 'secret')", params: map[string]any{"tag": []string{"public", "secret"}}, expected: false},
+		{name: "Single value", express: "allow: any($tag, t -> t == 'public') and all($tag, t -> t == 'public')", params: map[string]any{"tag": "public"}, expected: true},
+		{name: "Missing - any", express: "allow: any($tag, t -> t == 'public')", params: map[string]any{}, expected: false},
+		{name: "Missing - all", express: "allow: all($tag, t -> t == 'public')", params: map[string]any{}, expected: true},
+		{name: "Numbers", express: "allow: all($ids, id -> id > 0 and id % 2 == 0)", params: map[string]any{"ids": []int{2, 4, 6}}, expected: true},
+		{name: "Path access", express: "allow: any($orders, o -> o.status == 'open' and o.amount < 100)", params: map[string]any{"orders": orders}, expected: true},
+		{name: "Nested", express: "allow: all($a, x -> any($b, y -> x == y))", params: map[string]any{"a": []any{1, 2}, "b": []any{3, 2, 1}}, expected: true},
+		{name: "Outer param in body", express: "allow: any($tag, t -> t == $want)", params: map[string]any{"tag": []string{"a", "b"}, "want": "b"}, expected: true},
+		{name: "List literal", express: "allow: any(['a', 'b'], t -> t == $want)", params: map[string]any{"want": "b"}, expected: true},
+		{name: "contains - list", express: "allow: contains($tag, 'public')", params: map[string]any{"tag": []string{"draft", "public"}}, expected: true},
+		{name: "contains - list number", express: "allow: contains($ids, 3)", params: map[string]any{"ids": []int64{1, 3}}, expected: true},
+		{name: "contains - string", express: "allow: contains($name, 'pub')", params: map[string]any{"name": "public"}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express)
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+			result, err := guard.Check(&SecurityContext{Params: tt.params})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// 多值参数不能直接比较
+	for _, express := range []string{
+		"deny: $tag == 'secret'",
+		"deny: $tag in ['secret']",
+		"deny: startsWith($tag, 'sec')",
+		"allow: any($tag, t -> t.name == 'a')",
+	} {
+		t.Run(express, func(t *testing.T) {
+			guard, err := NewGuard(express)
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+			if _, err := guard.Check(&SecurityContext{Params: map[string]any{"tag": []string{"public", "secret"}}}); err == nil {
+				t.Error("Expected error for multi-valued parameter")
+			}
+		})
+	}
+
+	parseErrors := []struct {
+		express string
+		code    ParseErrorCode
+	}{
+		{"allow: any($tag)", CodeInvalidArgument},
+		{"allow: any($tag, t)", CodeInvalidArgument},
+		{"allow: all($tag, 'a' -> true)", CodeInvalidArgument},
+		{"allow: any($tag, t -> t + 1)", CodeInvalidArgument},
+		{"allow: any($tag, t -> t == 'a'", CodeUnbalancedParen},
+		{"allow: any($tag, t -> t == 'a') and t == 'b'", CodeSyntax},
+	}
+	for _, tt := range parseErrors {
+		t.Run(tt.express, func(t *testing.T) {
+			_, err := NewGuard(tt.express)
+			var pe *ParseError
+			if !errors.As(err, &pe) || pe.Code != tt.code {
+				t.Errorf("Expected %s, got %v", tt.code, err)
+			}
+		})
+	}
+}
+
+func TestGuard_Time(t *testing.T) {
+	// 2026-10-16 周五 UTC 01:30 , 上海时间 09:30
+	now := time.Date(2026, 10, 16, 1, 30, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	tests := []struct {
+		name     string
+		express  string
+		params   map[string]any
+		custom   map[string]string
+		expected bool
+	}{
+		{name: "Before date", express: "allow: now() < date('2026-12-31')", expected: true},
+		{name: "After date", express: "allow: now() > date('2026-12-31')", expected: false},
+		{name: "Date with zone", express: "allow: now() == date('2026-10-16T09:30:00+08:00')", expected: true},
+		{name: "Date time", express: "allow: now() >= date('2026-10-16 01:30:00')", expected: true},
+		{name: "Business hours", express: "allow: hour(now(), 'Asia/Shanghai') >= 9 and hour(now(), 'Asia/Shanghai') < 18", expected: true},
+		{name: "Business hours - UTC", express: "allow: hour(now(), 'UTC') >= 9", expected: false},
+		{name: "Weekday", express: "allow: weekday(now(), 'Asia/Shanghai') == 5", expected: true},
+		{name: "Weekday - zone changes day", express: "allow: weekday(now(), 'America/Los_Angeles') == 4", expected: true},
+		{name: "Zone from param", express: "allow: hour(now(), $query.tz) == 9", params: map[string]any{"query.tz": "Asia/Shanghai"}, expected: true},
+		{name: "Issued within 24h", express: "allow: now() - date(#iat) < duration('24h')", custom: map[string]string{"iat": "1792110600"}, expected: true},
+		{name: "Issued before 24h", express: "allow: now() - date(#iat) < duration('24h')", custom: map[string]string{"iat": "1792024200"}, expected: false},
+		{name: "Expire time", express: "allow: date($issued) + duration('30m') > now()", params: map[string]any{"issued": "2026-10-16T01:00:01Z"}, expected: true},
+		{name: "Native time", express: "allow: $order.created + duration('1h') >= now()", params: map[string]any{"order": map[string]any{"created": now.Add(-time.Hour)}}, expected: true},
+		{name: "Native duration", express: "allow: $ttl > duration('1m')", params: map[string]any{"ttl": 2 * time.Minute}, expected: true},
+		{name: "Duration seconds", express: "allow: duration(90) == duration('1m30s')", expected: true},
+		{name: "Duration arithmetic", express: "allow: duration('1h') * 2 - duration('30m') == duration('90m') and duration('1h') / 4 == duration('15m')", expected: true},
+		{name: "Time not equal to string", express: "allow: $date == now()", params: map[string]any{"date": "2026-10-16T01:30:00Z"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express)
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+			result, err := guard.Check(&SecurityContext{Params: tt.params, CustomParams: tt.custom, Clock: clock})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// 未设置时钟时使用当前时间
+	guard, err := NewGuard("allow: now() > date('2000-01-01') and now() - now() < duration('1s')")
+	if err != nil {
+		t.Fatalf("Failed to create guard: %v", err)
+	}
+	if result, err := guard.Check(&SecurityContext{}); err != nil || !result {
+		t.Errorf("Expected true, got %v, %v", result, err)
+	}
+
+	// 运行时错误
+	runtimeErrors := []struct {
+		express string
+		params  map[string]any
+		err     error
+	}{
+		{"allow: $a < now()", map[string]any{"a": "5"}, ErrTypeMismatch},
+		{"allow: $a + duration('1h') > now()", map[string]any{"a": 1}, ErrTypeMismatch},
+		{"allow: date($a) < now()", map[string]any{"a": "yesterday"}, nil},
+		{"allow: hour(now(), $tz) == 1", map[string]any{"tz": "Local"}, nil},
+	}
+	for _, tt := range runtimeErrors {
+		t.Run(tt.express, func(t *testing.T) {
+			guard, err := NewGuard(tt.express)
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+			_, err = guard.Check(&SecurityContext{Params: tt.params, Clock: clock})
+			if err == nil || tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Expected error %v, got %v", tt.err, err)
+			}
+		})
+	}
+
+	parseErrors := []struct {
+		express string
+		code    ParseErrorCode
+	}{
+		{"allow: now() == 1", CodeMismatchedTypes},
+		{"allow: now() + now() > now()", CodeMismatchedTypes},
+		{"allow: duration('1h') > 60", CodeMismatchedTypes},
+		{"allow: now() % 2 == 0", CodeMismatchedTypes},
+		{"allow: date('2026-13-01') > now()", CodeInvalidArgument},
+		{"allow: duration('1 day') > duration('1h')", CodeInvalidArgument},
+		{"allow: hour(now(), 'Mars/Base') > 1", CodeInvalidArgument},
+		{"allow: hour(now(), 'Local') > 1", CodeInvalidArgument},
+		{"allow: hour(now()) > 1", CodeInvalidArgument},
+	}
+	for _, tt := range parseErrors {
+		t.Run(tt.express, func(t *testing.T) {
+			_, err := NewGuard(tt.express)
+			var pe *ParseError
+			if !errors.As(err, &pe) || pe.Code != tt.code {
+				t.Errorf("Expected %s, got %v", tt.code, err)
+			}
+		})
+	}
+}
+
+func TestGuard_Literals(t *testing.T) {
+	tests := []struct {
+		name      string
+		express   string
+		params    map[string]any
+		custom    map[string]string
+		expected  bool
+		wantError bool
+	}{
+		{
+			name:     "Bool literal",
+			express:  "allow: true",
+			expected: true,
+		},
+		{
+			name:     "Negate bool literal",
+			express:  "allow: !false and true",
+			expected: true,
+		},
+		{
+			name:     "Custom parameter equals true",
+			express:  "allow: #isVerified == true",
+			custom:   map[string]string{"isVerified": "true"},
+			expected: true,
+		},
+		{
+			name:     "Custom parameter not verified",
+			express:  "allow: #isVerified == true",
+			custom:   map[string]string{"isVerified": "false"},
+			expected: false,
+		},
+		{
+			name:     "Bool parameter",
+			express:  "allow: $active != false",
+			params:   map[string]any{"active": true},
+			expected: true,
+		},
+		{
+			name:     "Number never equals bool",
+			express:  "allow: $count == true",
+			params:   map[string]any{"count": 1},
+			expected: false,
+		},
+		{
+			name:     "Parameter not null",
+			express:  "allow: $tenant != null",
+			params:   map[string]any{"tenant": "acme"},
+			expected: true,
+		},
+		{
+			name:     "Empty parameter is not null",
+			express:  "allow: $tenant != null",
+			params:   map[string]any{"tenant": ""},
+			expected: true,
+		},
+		{
+			name:     "Missing parameter is null",
+			express:  "allow: $tenant == null",
+			params:   map[string]any{},
+			expected: true,
+		},
+		{
+			name:     "Null equals null",
+			express:  "allow: null == null",
+			expected: true,
+		},
+		{
+			name:      "Non-bool parameter in logic operation",
+			express:   "allow: $tenant and true",
+			params:    map[string]any{"tenant": "acme"},
+			wantError: true,
+		},
+		{
+			name:      "Null in math operation",
+			express:   "allow: null + 1 == 1",
+			wantError: true,
+		},
+		{
+			name:      "Null in ordering comparison",
+			express:   "allow: $age > null",
+			wantError: true,
+		},
+		{
+			name:      "Bool compared with string constant",
+			express:   "allow: true == 'true'",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express)
+			if err != nil {
+				if !tt.wantError {
+					t.Fatalf("Failed to create guard: %v", err)
+				}
+				return
+			}
+
+			result, err := guard.Check(&SecurityContext{
+				Params:       tt.params,
+				CustomParams: tt.custom,
+			})
+			if tt.wantError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGuard_Membership(t *testing.T) {
+	tests := []struct {
+		name      string
+		express   string
+		params    map[string]any
+		custom    map[string]string
+		expected  bool
+		wantError bool
+	}{
+		{
+			name:     "String in list",
+			express:  "allow: $category in ['book', 'music', 'film']",
+			params:   map[string]any{"category": "music"},
+			expected: true,
+		},
+		{
+			name:     "String not in list",
+			express:  "allow: $category in ['book', 'music', 'film']",
+			params:   map[string]any{"category": "game"},
+			expected: false,
+		},
+		{
+			name:     "Not in",
+			express:  "allow: $category not in ['book', 'music']",
+			params:   map[string]any{"category": "game"},
+			expected: true,
+		},
+		{
+			name:     "Number in mixed list",
+			express:  "allow: $level in ['a', 3, 4.5]",
+			params:   map[string]any{"level": 3},
+			expected: true,
+		},
+		{
+			name:     "Numeric string in list of numbers",
+			express:  "allow: #level in [1, 2, 3]",
+			custom:   map[string]string{"level": "2"},
+			expected: true,
+		},
+		{
+			name:     "Bool in list",
+			express:  "allow: #isVerified in [true]",
+			custom:   map[string]string{"isVerified": "true"},
+			expected: true,
+		},
+		{
+			name:     "Number never in list of bools",
+			express:  "allow: $count in [true]",
+			params:   map[string]any{"count": 1},
+			expected: false,
+		},
+		{
+			name:     "Missing parameter in list with null",
+			express:  "allow: $tenant in [null, 'acme']",
+			params:   map[string]any{},
+			expected: true,
+		},
+		{
+			name:     "Empty list",
+			express:  "allow: $category in []",
+			params:   map[string]any{"category": "book"},
+			expected: false,
+		},
+		{
+			name:     "Combined with logic operators",
+			express:  "allow: Role('admin') or $category in ['public'] and $id not in [1, 2]",
+			params:   map[string]any{"category": "public", "id": 3},
+			expected: true,
+		},
+		{
+			name:     "Negate membership",
+			express:  "allow: !($category in ['book'])",
+			params:   map[string]any{"category": "music"},
+			expected: true,
+		},
+		{
+			name:     "Parameter name starts with in",
+			express:  "allow: $index in [1]",
+			params:   map[string]any{"index": 1},
+			expected: true,
+		},
+		{
+			name:      "Right side is not a list",
+			express:   "allow: $category in 'book'",
+			wantError: true,
+		},
+		{
+			name:      "List compared with equals",
+			express:   "allow: $category == ['book']",
+			wantError: true,
+		},
+		{
+			name:      "Parameter in list literal",
+			express:   "allow: $category in [$other]",
+			wantError: true,
+		},
+		{
+			name:      "Unclosed list",
+			express:   "allow: $category in ['book'",
+			wantError: true,
+		},
+		{
+			name:      "Trailing comma",
+			express:   "allow: $category in ['book',]",
+			wantError: true,
+		},
+		{
+			name:      "Not without in",
+			express:   "allow: $category not ['book']",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express)
+			if err != nil {
+				if !tt.wantError {
+					t.Fatalf("Failed to create guard: %v", err)
+				}
+				return
+			}
+
+			result, err := guard.Check(&SecurityContext{
+				Principal:    &testPrincipal{},
+				Params:       tt.params,
+				CustomParams: tt.custom,
+			})
+			if tt.wantError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+// in 使用解析时构建的索引，结果(包括错误)需要与逐个 == 比较一致
+func TestGuard_MembershipIndex(t *testing.T) {
+	lists := [][]any{
+		{"a", 1, 2.5, true, nil},
+		{"1.0", "true", " 2 ", 3},
+		{nil, "x", 1, "1"},
+		{1, "a", false},
+		{0.1, "0.10", int64(9007199254740993), 2.0},
+	}
+	values := []any{
+		nil, "a", "1", "1.0", "2.50", "true", "TRUE", "t", "x", " 2 ", "3", "0.1",
+		1, int64(3), 2.5, 1.0, 0.1, 1e21, uint8(1), float32(0.1), int64(9007199254740993), 9007199254740992.0,
+		true, false, time.Duration(1), time.Unix(0, 0), map[string]any{},
+	}
+	modes := map[string][]GuardOption{
+		"default":        nil,
+		"decimal":        {WithGuardDecimal()},
+		"strict":         {WithGuardStrictTypes()},
+		"decimal strict": {WithGuardDecimal(), WithGuardStrictTypes()},
+	}
+	literal := func(v any) string {
+		switch v := v.(type) {
+		case nil:
+			return "null"
+		case string:
+			return "'" + v + "'"
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return fmt.Sprint(v)
+	}
+	for mode, options := range modes {
+		for _, items := range lists {
+			literals := make([]string, len(items))
+			chain := make([]string, len(items))
+			for i, item := range items {
+				literals[i] = literal(item)
+				chain[i] = "$v == " + literals[i]
+			}
+			in, err := NewGuard("allow: $v in ["+strings.Join(literals, ", ")+"]", options...)
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+			eq, err := NewGuard("allow: "+strings.Join(chain, " or "), options...)
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+			contains, err := NewGuard("allow: contains($list, $v)", options...)
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+			for _, v := range values {
+				context := &SecurityContext{Params: map[string]any{"v": v, "list": items}}
+				expected, expectedErr := eq.Check(context)
+				for name, g := range map[string]Guard{"in": in, "contains": contains} {
+					result, err := g.Check(context)
+					if (err != nil) != (expectedErr != nil) || err == nil && result != expected {
+						t.Errorf("%s %s %v (%T) in %v: expected %v, %v, got %v, %v", mode, name, v, v, literals, expected, expectedErr, result, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestGuard_StringFunctions(t *testing.T) {
+	tests := []struct {
+		name      string
+		express   string
+		params    map[string]any
+		expected  bool
+		wantError bool
+	}{
+		{
+			name:     "startsWith wildcard parameter",
+			express:  "allow: startsWith($0, 'public/')",
+			params:   map[string]any{"0": "public/logo.png"},
+			expected: true,
+		},
+		{
+			name:     "startsWith not matched",
+			express:  "allow: startsWith($0, 'public/')",
+			params:   map[string]any{"0": "private/key.pem"},
+			expected: false,
+		},
+		{
+			name:     "endsWith",
+			express:  "allow: endsWith($file, '.png')",
+			params:   map[string]any{"file": "logo.png"},
+			expected: true,
+		},
+		{
+			name:     "contains",
+			express:  "allow: !contains($path, '..')",
+			params:   map[string]any{"path": "a/../b"},
+			expected: false,
+		},
+		{
+			name:     "matches",
+			express:  `allow: matches($sku, '^[A-Z]{3}-\d+$')`,
+			params:   map[string]any{"sku": "ABC-123"},
+			expected: true,
+		},
+		{
+			name:     "matches not matched",
+			express:  `allow: matches($sku, '^[A-Z]{3}-\d+$')`,
+			params:   map[string]any{"sku": "abc-123"},
+			expected: false,
+		},
+		{
+			name:     "lower",
+			express:  "allow: lower($name) == 'admin'",
+			params:   map[string]any{"name": "AdMin"},
+			expected: true,
+		},
+		{
+			name:     "upper",
+			express:  "allow: upper($code) in ['CN', 'US']",
+			params:   map[string]any{"code": "cn"},
+			expected: true,
+		},
+		{
+			name:     "len counts characters",
+			express:  "allow: len($name) <= 2",
+			params:   map[string]any{"name": "张三"},
+			expected: true,
+		},
+		{
+			name:     "Number parameter as string",
+			express:  "allow: startsWith($id, '10')",
+			params:   map[string]any{"id": 1024},
+			expected: true,
+		},
+		{
+			name:     "Nested function call",
+			express:  "allow: startsWith(lower($0), 'public/') and len($0) > 7",
+			params:   map[string]any{"0": "Public/a.png"},
+			expected: true,
+		},
+		{
+			name:     "Expression as argument",
+			express:  "allow: len($name) + 1 == 6",
+			params:   map[string]any{"name": "alice"},
+			expected: true,
+		},
+		{
+			name:      "Missing parameter",
+			express:   "allow: startsWith($0, 'public/')",
+			params:    map[string]any{},
+			wantError: true,
+		},
+		{
+			name:      "Invalid regular expression",
+			express:   "allow: matches($sku, '[A-Z')",
+			wantError: true,
+		},
+		{
+			name:      "Regular expression is not a constant",
+			express:   "allow: matches($sku, $pattern)",
+			wantError: true,
+		},
+		{
+			name:      "Wrong number of arguments",
+			express:   "allow: startsWith($0)",
+			wantError: true,
+		},
+		{
+			name:      "Wrong argument type",
+			express:   "allow: startsWith(true, 'public/')",
+			wantError: true,
+		},
+		{
+			name:      "Missing closing parenthesis",
+			express:   "allow: startsWith($0, 'public/'",
+			wantError: true,
+		},
+		{
+			name:      "Comma outside function call",
+			express:   "allow: ($a, $b)",
+			wantError: true,
+		},
+		{
+			name:      "String function result in logic operation",
+			express:   "allow: lower($name) and true",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express)
+			if err != nil {
+				if !tt.wantError {
+					t.Fatalf("Failed to create guard: %v", err)
+				}
+				return
+			}
+
+			result, err := guard.Check(&SecurityContext{
+				Principal: &testPrincipal{},
+				Params:    tt.params,
+			})
+			if tt.wantError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGuard_CustomFunctions(t *testing.T) {
+	businessHours := true
+	isBusinessHours := WithGuardFunction("IsBusinessHours", Signature{Return: TypeBool},
+		func(context *SecurityContext, args []any) (any, error) {
+			return businessHours, nil
+		})
+	hasLicense := WithGuardFunction("HasLicense", Signature{Args: []ValueType{TypeString}, Return: TypeBool},
+		func(context *SecurityContext, args []any) (any, error) {
+			return context.CustomParams["license"] == args[0], nil
+		})
+	sameTenant := WithGuardFunction("SameTenant", Signature{Args: []ValueType{TypeString | TypeNumber, TypeAny}, Return: TypeBool},
+		func(context *SecurityContext, args []any) (any, error) {
+			return fmt.Sprint(args[0]) == fmt.Sprint(args[1]), nil
+		})
+	broken := WithGuardFunction("Broken", Signature{Return: TypeBool},
+		func(context *SecurityContext, args []any) (any, error) {
+			return "yes", nil
+		})
+	failing := WithGuardFunction("Failing", Signature{Return: TypeBool},
+		func(context *SecurityContext, args []any) (any, error) {
+			return nil, fmt.Errorf("license server unavailable")
+		})
+
+	tests := []struct {
+		name      string
+		express   string
+		options   []GuardOption
+		params    map[string]any
+		custom    map[string]string
+		expected  bool
+		wantError bool
+	}{
+		{
+			name:     "Function without arguments",
+			express:  "allow: IsBusinessHours()",
+			options:  []GuardOption{isBusinessHours},
+			expected: true,
+		},
+		{
+			name:     "Function with constant argument and context",
+			express:  "allow: HasLicense('pro') and IsBusinessHours()",
+			options:  []GuardOption{isBusinessHours, hasLicense},
+			custom:   map[string]string{"license": "pro"},
+			expected: true,
+		},
+		{
+			name:     "Function with parameter arguments",
+			express:  "allow: SameTenant($tenant, #tenant)",
+			options:  []GuardOption{sameTenant},
+			params:   map[string]any{"tenant": 42},
+			custom:   map[string]string{"tenant": "42"},
+			expected: true,
+		},
+		{
+			name:     "Parameter with the same name as a function",
+			express:  "allow: $len == 3 and #order == 'desc' and $in == 1",
+			params:   map[string]any{"len": 3, "in": 1},
+			custom:   map[string]string{"order": "desc"},
+			expected: true,
+		},
+		{
+			name:      "Argument type mismatch",
+			express:   "allow: HasLicense(1)",
+			options:   []GuardOption{hasLicense},
+			wantError: true,
+		},
+		{
+			name:      "Wrong number of arguments",
+			express:   "allow: HasLicense()",
+			options:   []GuardOption{hasLicense},
+			wantError: true,
+		},
+		{
+			name:      "Unregistered function",
+			express:   "allow: IsBusinessHours()",
+			wantError: true,
+		},
+		{
+			name:      "Unexpected return value",
+			express:   "allow: Broken()",
+			options:   []GuardOption{broken},
+			wantError: true,
+		},
+		{
+			name:      "Function error",
+			express:   "allow: Failing()",
+			options:   []GuardOption{failing},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express, tt.options...)
+			if err != nil {
+				if !tt.wantError {
+					t.Fatalf("Failed to create guard: %v", err)
+				}
+				return
+			}
+
+			result, err := guard.Check(&SecurityContext{
+				Principal:    &testPrincipal{},
+				Params:       tt.params,
+				CustomParams: tt.custom,
+			})
+			if tt.wantError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("Invalid function names", func(t *testing.T) {
+		impl := func(context *SecurityContext, args []any) (any, error) { return true, nil }
+		for _, name := range []string{"Role", "lower", "and", "true", "1abc", "has-license", ""} {
+			if _, err := NewGuard("allow: true", WithGuardFunction(name, Signature{Return: TypeBool}, impl)); err == nil {
+				t.Errorf("Expected error for function name %q", name)
+			}
+		}
+	})
+
+	t.Run("Invalid signature", func(t *testing.T) {
+		impl := func(context *SecurityContext, args []any) (any, error) { return true, nil }
+		if _, err := NewGuard("allow: true", WithGuardFunction("NoReturn", Signature{}, impl)); err == nil {
+			t.Error("Expected error for missing return type")
+		}
+		if _, err := NewGuard("allow: true", WithGuardFunction("NoImpl", Signature{Return: TypeBool}, nil)); err == nil {
+			t.Error("Expected error for nil impl")
+		}
+	})
+}
+
+func TestGuard_Principal(t *testing.T) {
+	alice := &attributedTestPrincipal{
+		testPrincipal: testPrincipal{id: "alice"},
+		attributes: map[string]any{
+			"department": "sales",
+			"level":      3,
+			"in":         true,
+		},
+	}
+
+	tests := []struct {
+		name      string
+		express   string
+		principal SecurityPrincipal
+		params    map[string]any
+		custom    map[string]string
+		expected  bool
+		wantError bool
+	}{
+		{
+			name:      "principal.id equals path parameter",
+			express:   "allow: principal.id == $userId",
+			principal: alice,
+			params:    map[string]any{"userId": "alice"},
+			expected:  true,
+		},
+		{
+			name:      "principal.id not equals path parameter",
+			express:   "allow: principal.id == $userId",
+			principal: alice,
+			params:    map[string]any{"userId": "bob"},
+			expected:  false,
+		},
+		{
+			name:      "Owner",
+			express:   "allow: Owner($userId) or Role('admin')",
+			principal: alice,
+			params:    map[string]any{"userId": "alice"},
+			expected:  true,
+		},
+		{
+			name:      "Owner with another user",
+			express:   "allow: Owner($userId)",
+			principal: alice,
+			params:    map[string]any{"userId": "bob"},
+			expected:  false,
+		},
+		{
+			name:      "Owner with empty id",
+			express:   "allow: Owner($userId)",
+			principal: &testPrincipal{},
+			params:    map[string]any{"userId": ""},
+			expected:  false,
+		},
+		{
+			name:      "Attribute equals custom parameter",
+			express:   "allow: principal.department == #department",
+			principal: alice,
+			custom:    map[string]string{"department": "sales"},
+			expected:  true,
+		},
+		{
+			name:      "Number attribute",
+			express:   "allow: principal.level >= 3",
+			principal: alice,
+			expected:  true,
+		},
+		{
+			name:      "Attribute named like a keyword",
+			express:   "allow: principal.in == true",
+			principal: alice,
+			expected:  true,
+		},
+		{
+			name:      "Missing attribute is null",
+			express:   "allow: principal.region == null",
+			principal: alice,
+			expected:  true,
+		},
+		{
+			name:      "Principal without attributes",
+			express:   "allow: principal.department == null and principal.id == 'bob'",
+			principal: &testPrincipal{id: "bob"},
+			expected:  true,
+		},
+		{
+			name:      "Principal is nil",
+			express:   "allow: principal.id == 'bob'",
+			wantError: true,
+		},
+		{
+			name:      "principal without attribute",
+			express:   "allow: principal == 'alice'",
+			wantError: true,
+		},
+		{
+			name:      "principal.id is a string",
+			express:   "allow: principal.id and true",
+			wantError: true,
+		},
+		{
+			name:      "Parameter named principal",
+			express:   "allow: $principal == 'alice'",
+			principal: alice,
+			params:    map[string]any{"principal": "alice"},
+			expected:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express)
+			if err != nil {
+				if !tt.wantError {
+					t.Fatalf("Failed to create guard: %v", err)
+				}
+				return
+			}
+
+			result, err := guard.Check(&SecurityContext{
+				Principal:    tt.principal,
+				Params:       tt.params,
+				CustomParams: tt.custom,
+			})
+			if tt.wantError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGuard_PathAccess(t *testing.T) {
+	type status string
+	type customer struct {
+		ID     string `json:"id"`
+		Level  uint8
+		secret string
+	}
+	type order struct {
+		Customer *customer `json:"customer"`
+		Status   status
+		Tags     []string
+	}
+
+	params := map[string]any{
+		"order": map[string]any{
+			"customer": map[string]any{"id": "c1", "vip": true},
+			"total":    99.5,
+		},
+		"items": []map[string]any{
+			{"sku": "A-1", "qty": 2},
+			{"sku": "B-2", "qty": 1},
+		},
+		"typed": &order{
+			Customer: &customer{ID: "c2", Level: 3, secret: "s"},
+			Status:   "paid",
+			Tags:     []string{"gift"},
+		},
+		"headers":      map[string]string{"x-tenant": "acme"},
+		"query.filter": map[string]any{"status": "open"},
+		"nothing":      nil,
+	}
+
+	tests := []struct {
+		name        string
+		express     string
+		expected    bool
+		wantError   bool
+		missingPath string
+	}{
+		{
+			name:     "Nested map",
+			express:  "allow: $order.customer.id == 'c1' and $order.customer.vip == true",
+			expected: true,
+		},
+		{
+			name:     "Number in nested map",
+			express:  "allow: $order.total > 99",
+			expected: true,
+		},
+		{
+			name:     "Index access",
+			express:  "allow: $items[0].sku == 'A-1' and $items[1].qty == 1",
+			expected: true,
+		},
+		{
+			name:     "Dot index access",
+			express:  "allow: $items.1.sku == 'B-2'",
+			expected: true,
+		},
+		{
+			name:     "Struct fields by name, json tag and pointer",
+			express:  "allow: $typed.Customer.ID == 'c2' and $typed.customer.id == 'c2' and $typed.customer.Level == 3",
+			expected: true,
+		},
+		{
+			name:     "Named string type",
+			express:  "allow: $typed.Status in ['paid', 'shipped']",
+			expected: true,
+		},
+		{
+			name:     "Slice field",
+			express:  "allow: $typed.Tags[0] == 'gift'",
+			expected: true,
+		},
+		{
+			name:     "String key access",
+			express:  "allow: $headers['x-tenant'] == 'acme'",
+			expected: true,
+		},
+		{
+			name:     "Namespaced parameter with path",
+			express:  "allow: $query.filter.status == 'open'",
+			expected: true,
+		},
+		{
+			name:     "Path in function argument",
+			express:  "allow: startsWith($items[0].sku, 'A-')",
+			expected: true,
+		},
+		{
+			name:        "Missing map key",
+			express:     "allow: $order.customer.name == 'c1'",
+			wantError:   true,
+			missingPath: "$order.customer.name",
+		},
+		{
+			name:        "Index out of range",
+			express:     "allow: $items[5].sku == 'A-1'",
+			wantError:   true,
+			missingPath: "$items[5].sku",
+		},
+		{
+			name:        "Unexported struct field",
+			express:     "allow: $typed.customer.secret == 's'",
+			wantError:   true,
+			missingPath: "$typed.customer.secret",
+		},
+		{
+			name:        "Path on null",
+			express:     "allow: $nothing.id == 'x'",
+			wantError:   true,
+			missingPath: "$nothing.id",
+		},
+		{
+			name:        "Path on missing parameter",
+			express:     "allow: $absent.id == 'x'",
+			wantError:   true,
+			missingPath: "$absent.id",
+		},
+		{
+			name:        "Path on string",
+			express:     "allow: $order.customer.id.value == 'x'",
+			wantError:   true,
+			missingPath: "$order.customer.id.value",
+		},
+		{
+			name:        "Path on custom parameter string",
+			express:     "allow: #order.id == 'x'",
+			wantError:   true,
+			missingPath: "#order.id",
+		},
+		{
+			name:      "Unclosed index",
+			express:   "allow: $items[0.sku == 'x'",
+			wantError: true,
+		},
+		{
+			name:      "Missing field name",
+			express:   "allow: $order. == 'x'",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express)
+			if err != nil {
+				if !tt.wantError || tt.missingPath != "" {
+					t.Fatalf("Failed to create guard: %v", err)
+				}
+				return
+			}
+
+			result, err := guard.Check(&SecurityContext{
+				Principal:    &testPrincipal{},
+				Params:       params,
+				CustomParams: map[string]string{"order": "1001"},
+			})
+			if tt.wantError {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+				var missing *MissingPathError
+				if !errors.As(err, &missing) {
+					t.Fatalf("Expected MissingPathError, got %v", err)
+				}
+				if missing.Path != tt.missingPath {
+					t.Errorf("Expected missing path %s, got %s", tt.missingPath, missing.Path)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestPermissionImplies(t *testing.T) {
+	tests := []struct {
+		held     string
+		required string
+		expected bool
+	}{
+		{"orders:read", "orders:read", true},
+		{"orders:read", "orders:write", false},
+		{"orders:*", "orders:read", true},
+		{"orders:*", "orders:read:1001", true},
+		{"orders", "orders:read:1001", true},
+		{"*", "docs:read", true},
+		{"*:read", "docs:read", true},
+		{"*:read", "docs:write", false},
+		{"docs:read,write:*", "docs:write:42", true},
+		{"docs:read,write:*", "docs:delete:42", false},
+		{"docs:read,write", "docs:read,write", true},
+		{"docs:read", "docs:read,write", false},
+		{"docs:read:*", "docs:read", true},
+		{"docs:read:42", "docs:read", false},
+		{"docs:read:42", "docs:read:43", false},
+		{"docs:read", "docs:*", false},
+		{"docs:*", "docs:*", true},
+		{"Docs:read", "docs:read", false},
+		{" docs : read ", "docs:read", true},
+		{"docs::read", "docs:read", false},
+		{"docs:read", "docs::read", false},
+		{"", "docs:read", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.held+" => "+tt.required, func(t *testing.T) {
+			if result := PermissionImplies(tt.held, tt.required); result != tt.expected {
+				t.Errorf("PermissionImplies(%q, %q) = %v, expected %v", tt.held, tt.required, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGuard_WildcardPermission(t *testing.T) {
+	principal := &testPrincipal{
+		permissions: []string{"orders:*", "docs:read,write:*", "reports:view:2024", "invalid::permission"},
+	}
+
+	tests := []struct {
+		name      string
+		express   string
+		options   []GuardOption
+		expected  bool
+		wantError bool
+	}{
+		{
+			name:     "Domain wildcard",
+			express:  "allow: Permission('orders:read')",
+			options:  []GuardOption{WithGuardWildcardPermission()},
+			expected: true,
+		},
+		{
+			name:     "Domain wildcard with instance",
+			express:  "allow: Permission('orders:refund:1001')",
+			options:  []GuardOption{WithGuardWildcardPermission()},
+			expected: true,
+		},
+		{
+			name:     "Comma separated actions",
+			express:  "allow: Permission('docs:write:42')",
+			options:  []GuardOption{WithGuardWildcardPermission()},
+			expected: true,
+		},
+		{
+			name:     "Action not held",
+			express:  "allow: Permission('docs:delete:42')",
+			options:  []GuardOption{WithGuardWildcardPermission()},
+			expected: false,
+		},
+		{
+			name:     "Required permission with multiple actions",
+			express:  "allow: Permission('docs:read,write')",
+			options:  []GuardOption{WithGuardWildcardPermission()},
+			expected: true,
+		},
+		{
+			name:     "Instance level permission does not imply action",
+			express:  "allow: Permission('reports:view')",
+			options:  []GuardOption{WithGuardWildcardPermission()},
+			expected: false,
+		},
+		{
+			name:     "Permissions matches any",
+			express:  "allow: Permissions('users:read', 'reports:view:2024')",
+			options:  []GuardOption{WithGuardWildcardPermission()},
+			expected: true,
+		},
+		{
+			name:     "Permissions matches none",
+			express:  "allow: Permissions('users:read', 'reports:view:2025')",
+			options:  []GuardOption{WithGuardWildcardPermission()},
+			expected: false,
+		},
+		{
+			name:     "Invalid held permission is ignored",
+			express:  "allow: Permission('invalid:read')",
+			options:  []GuardOption{WithGuardWildcardPermission()},
+			expected: false,
+		},
+		{
+			name:     "Combined with custom function",
+			express:  "allow: Permission('orders:read') and IsTrue(true)",
+			options:  []GuardOption{WithGuardFunction("IsTrue", Signature{Args: []ValueType{TypeBool}, Return: TypeBool}, func(_ *SecurityContext, args []any) (any, error) { return args[0], nil }), WithGuardWildcardPermission()},
+			expected: true,
+		},
+		{
+			name:      "Invalid required permission",
+			express:   "allow: Permission('orders::read')",
+			options:   []GuardOption{WithGuardWildcardPermission()},
+			wantError: true,
+		},
+		{
+			name:      "Invalid required permission in Permissions",
+			express:   "allow: Permissions('orders:read', ':read')",
+			options:   []GuardOption{WithGuardWildcardPermission()},
+			wantError: true,
+		},
+		{
+			name:     "Exact matching by default",
+			express:  "allow: Permission('orders:read')",
+			expected: false,
+		},
+		{
+			name:     "Exact matching of wildcard string by default",
+			express:  "allow: Permission('orders:*')",
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express, tt.options...)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("Expected parse error for %s", tt.express)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+
+			result, err := guard.Check(&SecurityContext{Principal: principal})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// 动态参数不能改变权限的层级或匹配范围
+	narrow := &testPrincipal{permissions: []string{"docs:123:read", "docs:7"}}
+	dynamicTests := []struct {
+		name      string
+		express   string
+		params    map[string]any
+		custom    map[string]string
+		expected  bool
+		wantError bool
+	}{
+		{name: "Plain value", express: "allow: Permission('docs:' + $docId)", params: map[string]any{"docId": "7"}, expected: true},
+		{name: "Narrower permission", express: "allow: Permission('docs:' + $docId)", params: map[string]any{"docId": "123"}, expected: false},
+		{name: "Injected part", express: "allow: Permission('docs:' + $docId)", params: map[string]any{"docId": "123:read"}, wantError: true},
+		{name: "Injected wildcard", express: "allow: Permission('docs:' + $docId + ':read')", params: map[string]any{"docId": "*"}, wantError: true},
+		{name: "Injected list", express: "allow: Permissions('docs:' + lower(#docId))", custom: map[string]string{"docId": "1,7"}, wantError: true},
+		{name: "AllPermissions", express: "allow: AllPermissions('docs:7', 'docs:' + $docId)", params: map[string]any{"docId": "7:*"}, wantError: true},
+		{name: "Constant parts unrestricted", express: "allow: Permission($domain + ':123:read')", params: map[string]any{"domain": "docs"}, expected: true},
+	}
+	for _, tt := range dynamicTests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express, WithGuardWildcardPermission())
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+			result, err := guard.Check(&SecurityContext{Principal: narrow, Params: tt.params, CustomParams: tt.custom})
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("Expected error, got %v", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// 未开启通配符权限时按原值精确匹配，不限制
+	guard, err := NewGuard("allow: Permission('docs:' + $docId)")
+	if err != nil {
+		t.Fatalf("Failed to create guard: %v", err)
+	}
+	if result, err := guard.Check(&SecurityContext{Principal: narrow, Params: map[string]any{"docId": "123:read"}}); err != nil || !result {
+		t.Errorf("Expected true, got %v, %v", result, err)
+	}
+}
+
+func TestRoleHierarchy(t *testing.T) {
+	hierarchy, err := ParseRoleHierarchy(`
+		# 管理线
+		admin > manager > user
+		admin > auditor
+		auditor > user
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse role hierarchy: %v", err)
+	}
+
+	tests := []struct {
+		held     string
+		required string
+		expected bool
+	}{
+		{"admin", "admin", true},
+		{"admin", "manager", true},
+		{"admin", "user", true},
+		{"admin", "auditor", true},
+		{"manager", "user", true},
+		{"auditor", "user", true},
+		{"manager", "admin", false},
+		{"manager", "auditor", false},
+		{"user", "manager", false},
+		{"guest", "guest", true},
+		{"guest", "user", false},
+	}
+	for _, tt := range tests {
+		if result := hierarchy.Implies(tt.held, tt.required); result != tt.expected {
+			t.Errorf("Implies(%q, %q) = %v, expected %v", tt.held, tt.required, result, tt.expected)
+		}
+	}
+
+	invalid := []struct {
+		name     string
+		text     string
+		inherits map[string][]string
+	}{
+		{name: "Cycle", text: "admin > manager > user\nuser > admin"},
+		{name: "Self cycle", text: "admin > admin"},
+		{name: "Single role", text: "admin"},
+		{name: "Empty role", text: "admin > > user"},
+		{name: "Cycle in map", inherits: map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}}},
+		{name: "Empty role in map", inherits: map[string][]string{"a": {""}}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.inherits != nil {
+				_, err = NewRoleHierarchy(tt.inherits)
+			} else {
+				_, err = ParseRoleHierarchy(tt.text)
+			}
+			if err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestGuard_RoleHierarchy(t *testing.T) {
+	hierarchy, err := NewRoleHierarchy(map[string][]string{
+		"admin":   {"manager"},
+		"manager": {"user"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create role hierarchy: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		express  string
+		roles    []string
+		options  []GuardOption
+		expected bool
+	}{
+		{
+			name:     "Higher role implies lower role",
+			express:  "allow: Role('manager')",
+			roles:    []string{"admin"},
+			options:  []GuardOption{WithGuardRoleHierarchy(hierarchy)},
+			expected: true,
+		},
+		{
+			name:     "Transitive",
+			express:  "allow: Role('user')",
+			roles:    []string{"admin"},
+			options:  []GuardOption{WithGuardRoleHierarchy(hierarchy)},
+			expected: true,
+		},
+		{
+			name:     "Lower role does not imply higher role",
+			express:  "allow: Role('admin')",
+			roles:    []string{"manager"},
+			options:  []GuardOption{WithGuardRoleHierarchy(hierarchy)},
+			expected: false,
+		},
+		{
+			name:     "Roles",
+			express:  "allow: Roles('auditor', 'user')",
+			roles:    []string{"guest", "manager"},
+			options:  []GuardOption{WithGuardRoleHierarchy(hierarchy)},
+			expected: true,
+		},
+		{
+			name:     "Roles without implied role",
+			express:  "allow: Roles('auditor', 'admin')",
+			roles:    []string{"manager"},
+			options:  []GuardOption{WithGuardRoleHierarchy(hierarchy)},
+			expected: false,
+		},
+		{
+			name:     "Deny policy",
+			express:  "deny: Role('user')",
+			roles:    []string{"admin"},
+			options:  []GuardOption{WithGuardRoleHierarchy(hierarchy)},
+			expected: false,
+		},
+		{
+			name:     "Combined with wildcard permission",
+			express:  "allow: Role('user') and Permission('orders:read')",
+			roles:    []string{"manager"},
+			options:  []GuardOption{WithGuardRoleHierarchy(hierarchy), WithGuardWildcardPermission()},
+			expected: true,
+		},
+		{
+			name:     "Without hierarchy",
+			express:  "allow: Role('manager')",
+			roles:    []string{"admin"},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express, tt.options...)
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+			principal := &testPrincipal{roles: tt.roles, permissions: []string{"orders:*"}}
+			result, err := guard.Check(&SecurityContext{Principal: principal})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGuard_AllOf(t *testing.T) {
+	hierarchy, err := ParseRoleHierarchy("admin > manager")
+	if err != nil {
+		t.Fatalf("Failed to parse role hierarchy: %v", err)
+	}
+	principal := &testPrincipal{
+		roles:       []string{"admin", "auditor"},
+		permissions: []string{"orders:read", "orders:write", "docs:*"},
+		groups:      []string{"sales", "east"},
+	}
+
+	tests := []struct {
+		name      string
+		express   string
+		options   []GuardOption
+		expected  bool
+		wantError bool
+	}{
+		{name: "AllRoles", express: "allow: AllRoles('admin', 'auditor')", expected: true},
+		{name: "AllRoles missing one", express: "allow: AllRoles('admin', 'manager')", expected: false},
+		{name: "AllRoles with hierarchy", express: "allow: AllRoles('admin', 'manager')", options: []GuardOption{WithGuardRoleHierarchy(hierarchy)}, expected: true},
+		{name: "AllPermissions", express: "allow: AllPermissions('orders:read', 'orders:write')", expected: true},
+		{name: "AllPermissions missing one", express: "allow: AllPermissions('orders:read', 'orders:delete')", expected: false},
+		{name: "AllPermissions with wildcard", express: "allow: AllPermissions('docs:read', 'docs:write', 'orders:read')", options: []GuardOption{WithGuardWildcardPermission()}, expected: true},
+		{name: "AllPermissions with invalid wildcard", express: "allow: AllPermissions('docs::read')", options: []GuardOption{WithGuardWildcardPermission()}, wantError: true},
+		{name: "AllGroups", express: "allow: AllGroups('sales', 'east')", expected: true},
+		{name: "AllGroups missing one", express: "allow: AllGroups('sales', 'west')", expected: false},
+		{name: "AllGroups combined", express: "allow: AllGroups('sales') and AllRoles('auditor')", expected: true},
+		{name: "AtLeast satisfied", express: "allow: AtLeast(2, Permissions('orders:read', 'orders:delete', 'orders:write'))", expected: true},
+		{name: "AtLeast not satisfied", express: "allow: AtLeast(2, Permissions('orders:read', 'orders:delete', 'orders:refund'))", expected: false},
+		{name: "AtLeast with roles", express: "allow: AtLeast(1, Roles('guest', 'auditor'))", expected: true},
+		{name: "AtLeast with groups", express: "allow: AtLeast(2, Groups('sales', 'east', 'west'))", expected: true},
+		{name: "AtLeast with wildcard", express: "allow: AtLeast(3, Permissions('docs:read', 'docs:write', 'orders:read'))", options: []GuardOption{WithGuardWildcardPermission()}, expected: true},
+		{name: "AtLeast negated", express: "allow: !AtLeast(3, Groups('sales', 'east', 'west'))", expected: true},
+		{name: "AtLeast with zero", express: "allow: AtLeast(0, Roles('admin'))", wantError: true},
+		{name: "AtLeast more than values", express: "allow: AtLeast(3, Roles('admin', 'auditor'))", wantError: true},
+		{name: "AtLeast with parameter", express: "allow: AtLeast($n, Roles('admin'))", wantError: true},
+		{name: "AtLeast with float", express: "allow: AtLeast(1.5, Roles('admin'))", wantError: true},
+		{name: "AtLeast with single value function", express: "allow: AtLeast(1, Role('admin'))", wantError: true},
+		{name: "AtLeast missing argument", express: "allow: AtLeast(1)", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express, tt.options...)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("Expected parse error for %s", tt.express)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+			result, err := guard.Check(&SecurityContext{Principal: principal})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGuard_BuiltinArguments(t *testing.T) {
+	hierarchy, err := ParseRoleHierarchy("acme-admin > member")
+	if err != nil {
+		t.Fatalf("Failed to parse role hierarchy: %v", err)
+	}
+	principal := &testPrincipal{
+		roles:       []string{"acme-admin"},
+		permissions: []string{"orders.acme.read", "reports:acme:*"},
+		groups:      []string{"team-42", "ops"},
+	}
+	params := map[string]any{"tenant": "acme", "teamId": "team-42", "team": 42, "flag": true, "role": "member"}
+	custom := map[string]string{"teamId": "team-42"}
+
+	tests := []struct {
+		name      string
+		express   string
+		options   []GuardOption
+		expected  bool
+		wantError bool
+		evalError bool
+	}{
+		{name: "Concatenated permission", express: "allow: Permission('orders.' + $tenant + '.read')", expected: true},
+		{name: "Missing parameter in concatenation", express: "allow: Permission('orders.' + $other + '.read')", evalError: true},
+		{name: "Path parameter", express: "allow: Group($teamId)", expected: true},
+		{name: "Custom parameter", express: "allow: Group(#teamId)", expected: true},
+		{name: "Number parameter is converted", express: "allow: Group('team-' + $team)", expected: true},
+		{name: "Role with concatenation", express: "allow: Role($tenant + '-admin')", expected: true},
+		{name: "Role with hierarchy", express: "allow: Role($role)", options: []GuardOption{WithGuardRoleHierarchy(hierarchy)}, expected: true},
+		{name: "String function argument", express: "allow: Role(lower('ACME') + '-admin')", expected: true},
+		{name: "Mixed arguments", express: "allow: Groups('dev', $teamId)", expected: true},
+		{name: "AllGroups with parameter", express: "allow: AllGroups($teamId, 'ops')", expected: true},
+		{name: "AtLeast with parameters", express: "allow: AtLeast(2, Groups('dev', #teamId, 'ops'))", expected: true},
+		{name: "Wildcard permission with parameter", express: "allow: Permission('reports:' + $tenant + ':view')", options: []GuardOption{WithGuardWildcardPermission()}, expected: true},
+		{name: "Invalid wildcard permission at runtime", express: "allow: Permission('reports::' + $tenant)", options: []GuardOption{WithGuardWildcardPermission()}, evalError: true},
+		{name: "Null argument", express: "allow: Group($missing)", evalError: true},
+		{name: "Bool argument", express: "allow: Group($flag)", evalError: true},
+		{name: "Number literal", express: "allow: Role(1)", wantError: true},
+		{name: "Bool literal", express: "allow: Role(true)", wantError: true},
+		{name: "Null literal", express: "allow: Permission(null)", wantError: true},
+		{name: "Bool expression", express: "allow: Groups('ops', $team == 1)", wantError: true},
+		{name: "No argument", express: "allow: Role()", wantError: true},
+		{name: "Too many arguments", express: "allow: Role('a', 'b')", wantError: true},
+		{name: "String concatenation", express: "allow: 'orders.' + $tenant == 'orders.acme'", expected: true},
+		{name: "Number addition", express: "allow: $team + 1 == 43", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express, tt.options...)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("Expected parse error for %s", tt.express)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+			result, err := guard.Check(&SecurityContext{Principal: principal, Params: params, CustomParams: custom})
+			if tt.evalError {
+				if err == nil {
+					t.Errorf("Expected evaluation error for %s", tt.express)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGuard_Precedence(t *testing.T) {
+	principal := &testPrincipal{roles: []string{"admin"}, groups: []string{"ops"}}
+	params := map[string]any{"a": 10, "b": 4, "c": 3, "flag": false}
+
+	tests := []struct {
+		express  string
+		expected bool
+	}{
+		{"allow: $a - $b - $c == 3", true},
+		{"allow: $a / 5 * 2 == 4", true},
+		{"allow: $a - $b * 2 == 2", true},
+		{"allow: true or false and false", true},
+		{"allow: (true or false) and false", false},
+		{"allow: !$flag == true", true},
+		{"allow: !$a == 10", false},
+		{"allow: !Role('guest') and Group('ops')", true},
+		{"allow: Role('admin') == true", true},
+		{"allow: Role('guest') == false and Group('ops') != false", true},
+		{"allow: $a > $b == true", true},
+		{"allow: !$c in [1, 2]", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.express, func(t *testing.T) {
+			guard, err := NewGuard(tt.express)
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+			result, err := guard.Check(&SecurityContext{Principal: principal, Params: params})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGuard_ParseErrors(t *testing.T) {
+	type diagnostic struct {
+		code   ParseErrorCode
+		token  string
+		line   int
+		column int
+	}
+	tests := []struct {
+		express  string
+		expected []diagnostic
+	}{
+		{
+			express:  "deny $a",
+			expected: []diagnostic{{CodeInvalidPolicy, "$", 1, 6}},
+		},
+		{
+			express:  "allow: $a ==",
+			expected: []diagnostic{{CodeSyntax, "", 1, 13}},
+		},
+		{
+			express:  "allow: Role('a')) and $b",
+			expected: []diagnostic{{CodeUnbalancedParen, ")", 1, 17}},
+		},
+		{
+			express: "allow: $a == 'x' + 1 and Role(1) and Foo($b)",
+			expected: []diagnostic{
+				{CodeMismatchedTypes, "+", 1, 18},
+				{CodeInvalidArgument, "Role", 1, 26},
+				{CodeUnknownFunction, "Foo", 1, 38},
+			},
+		},
+		{
+			express: "allow: Roles() or\n  ($a > and AtLeast(3, Roles('a')))\n  or ]",
+			expected: []diagnostic{
+				{CodeInvalidArgument, "Roles", 1, 8},
+				{CodeSyntax, "and", 2, 9},
+				{CodeInvalidArgument, "AtLeast", 2, 13},
+				{CodeSyntax, "]", 3, 6},
+			},
+		},
+		{
+			express: "allow: 'é' == Role(",
+			expected: []diagnostic{
+				{CodeUnbalancedParen, "Role", 1, 15},
+				{CodeSyntax, "", 1, 20},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.express, func(t *testing.T) {
+			_, err := NewGuard(tt.express)
+			var errs ParseErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Expected ParseErrors, got %v", err)
+			}
+			if len(errs) != len(tt.expected) {
+				t.Fatalf("Expected %d errors, got %d: %v", len(tt.expected), len(errs), err)
+			}
+			for i, e := range errs {
+				got := diagnostic{e.Code, e.Token, e.Line, e.Column}
+				if got != tt.expected[i] {
+					t.Errorf("Error %d: expected %+v, got %+v", i, tt.expected[i], got)
+				}
+			}
+
+			var first *ParseError
+			if !errors.As(err, &first) || first != errs[0] {
+				t.Errorf("Expected errors.As to return the first ParseError")
+			}
+		})
+	}
+}
+
+func TestGuard_StaticCheck(t *testing.T) {
+	tests := []struct {
+		express    string
+		nonBoolean bool
+		warnings   []string
+	}{
+		{express: "allow: $a + 1", nonBoolean: true},
+		{express: "allow: 'yes'", nonBoolean: true},
+		{express: "allow: lower($a)", nonBoolean: true},
+		{express: "allow: $a"},
+		{express: "allow"},
+		{express: "allow: $a > 1 and $b == null"},
+		{express: "allow: $a > '10'"},
+		{express: "allow: $a > 'abc'", warnings: []string{"$a > 'abc'"}},
+		{express: "allow: true <= $a or Role('x') > $b", warnings: []string{"true <= $a", "Role('x') > $b"}},
+		{express: "allow: Role('x') == null or null != principal.name", warnings: []string{"Role('x') == null"}},
+		{express: "allow: principal.id != null", warnings: []string{"principal.id != null"}},
+		{express: "allow: ($a < 'x') == true", warnings: []string{"($a < 'x')"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.express, func(t *testing.T) {
+			guard, err := NewGuard(tt.express)
+			if tt.nonBoolean {
+				var errs ParseErrors
+				if !errors.As(err, &errs) || errs[0].Code != CodeNonBoolean {
+					t.Fatalf("Expected non-boolean error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+
+			warnings := guard.Warnings()
+			if len(warnings) != len(tt.warnings) {
+				t.Fatalf("Expected %d warnings, got %v", len(tt.warnings), warnings)
+			}
+			for i, w := range warnings {
+				if w.Code != CodeIncomparableTypes || w.Token != tt.warnings[i] {
+					t.Errorf("Expected warning on %s, got %s %s", tt.warnings[i], w.Code, w.Token)
+				}
+			}
+		})
+	}
+}
+
+func TestGuard_EdgeCases(t *testing.T) {
+	tests := []struct {
+		name      string
+		express   string
+		principal *testPrincipal
+		params    map[string]any
+		custom    map[string]string
+		expected  bool
+		wantError bool
+	}{
+		{
+			name:    "Empty roles array",
+			express: "allow: Role('admin')",
+			principal: &testPrincipal{
+				roles: []string{},
+			},
+			expected: false,
+		},
+		{
+			name:      "Nil principal",
+			express:   "allow: Role('admin')",
+			principal: nil,
+			wantError: true,
+		},
+		{
+			name:     "Missing parameter",
+			express:  "allow: $nonexistent == 'value'",
+			params:   map[string]any{},
+			expected: false,
+		},
+		{
+			name:    "Type mismatch in comparison",
+			express: "allow: $stringParam > 10",
+			params: map[string]any{
+				"stringParam": "hello",
+			},
+			wantError: true,
+		},
+		{
+			name:     "Always true expression",
+			express:  "allow: 1 == 1",
+			expected: true,
+		},
+		{
+			name:     "Always false expression",
+			express:  "allow: 1 == 2",
+			expected: false,
+		},
+		{
+			name:     "Policy only - allow",
+			express:  "allow",
+			expected: true,
+		},
+		{
+			name:     "Policy only - deny",
+			express:  "deny",
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express)
+			if err != nil {
+				if !tt.wantError {
+					t.Fatalf("Failed to create guard: %v", err)
+				}
+				return
+			}
+
+			var result bool
+			var checkErr error
+
+			// Handle potential panic from nil principal
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						checkErr = fmt.Errorf("panic occurred: %v", r)
+					}
+				}()
+				result, checkErr = guard.Check(&SecurityContext{
+					Principal:    tt.principal,
+					Params:       tt.params,
+					CustomParams: tt.custom,
+				})
+			}()
+
+			if tt.wantError {
+				if checkErr == nil {
+					t.Error("Expected error but got none")
+				}
+			} else {
+				if checkErr != nil {
+					t.Errorf("Unexpected error: %v", checkErr)
+				}
+				if result != tt.expected {
+					t.Errorf("Expected %v, got %v", tt.expected, result)
+				}
+			}
+		})
+	}
+}
+
+func TestGuard_Decide(t *testing.T) {
+	express := "deny: Role('guest') and $action == 'delete'"
+	guard, err := NewGuard(express)
+	if err != nil {
+		t.Fatalf("Failed to create guard: %v", err)
+	}
+
+	decision, err := guard.Decide(&SecurityContext{
+		Principal: &testPrincipal{roles: []string{"guest"}},
+		Params: map[string]any{
+			"action": "delete",
+		},
+		CustomParams: map[string]string{
+			"env": "production",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if decision.Allowed {
+		t.Error("Expected decision to deny")
+	}
+	if !decision.Matched || decision.Policy != "deny" || decision.Express != express {
+		t.Errorf("Unexpected decision: %+v", decision)
+	}
+
+	expectedParams := []DecisionParam{
+		{Name: "action", Value: "delete"},
+		{Source: ParamSourceCustom, Name: "env", Value: "production"},
+	}
+	if fmt.Sprint(decision.Params) != fmt.Sprint(expectedParams) {
+		t.Errorf("Expected params %v, got %v", expectedParams, decision.Params)
+	}
+}
+
+func TestGuard_Explain(t *testing.T) {
+	guard, err := NewGuard("allow: Role('admin') or ($quota < 10 and !Group('banned'))")
+	if err != nil {
+		t.Fatalf("Failed to create guard: %v", err)
+	}
+
+	explanation, err := guard.Explain(&SecurityContext{
+		Principal: &testPrincipal{roles: []string{"user"}},
+		Params: map[string]any{
+			"quota": 12,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if explanation.Allowed {
+		t.Error("Expected explanation to deny")
+	}
+
+	root := explanation.Trace
+	if root.Operator != "or" || root.Value != false || len(root.Operands) != 2 {
+		t.Fatalf("Unexpected root trace: %+v", root)
+	}
+	if root.Operands[0].Text != "Role('admin')" || root.Operands[0].Value != false {
+		t.Errorf("Unexpected left trace: %+v", root.Operands[0])
+	}
+	if root.Operands[1].Text != "($quota < 10 and !Group('banned'))" {
+		t.Errorf("Unexpected right trace text: %s", root.Operands[1].Text)
+	}
+	quota := root.Operands[1].Operands[0].Operands[0]
+	if quota.Text != "$quota" || quota.Value != 12 {
+		t.Errorf("Unexpected param trace: %+v", quota)
+	}
+	if negate := root.Operands[1].Operands[1]; !negate.Skipped || negate.Operands != nil {
+		t.Errorf("Expected short-circuited operand to be skipped: %+v", negate)
+	}
+
+	expected := `allow: Role('admin') or ($quota < 10 and !Group('banned'))
+       ^^^^^^^^^^^^^ Role => false
+                         ^^^^^^ 12
+                                  ^^ 10
+                         ^^^^^^^^^^^ < => false
+                                         ^^^^^^^^^^^^^^^^ ! => skipped
+                        ^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^ and => false
+       ^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^ or => false
+=> allow: false
+`
+	if explanation.String() != expected {
+		t.Errorf("Unexpected rendered explanation:\n%s", explanation.String())
+	}
+}
+
+func TestGuard_ShortCircuit(t *testing.T) {
+	tests := []struct {
+		name      string
+		express   string
+		principal *testPrincipal
+		params    map[string]any
+		expected  bool
+		wantError bool
+	}{
+		{
+			name:      "Or skips right side when left is true",
+			express:   "allow: Role('admin') or $quota < 10",
+			principal: &testPrincipal{roles: []string{"admin"}},
+			params:    map[string]any{"quota": "unlimited"},
+			expected:  true,
+		},
+		{
+			name:      "Or evaluates right side when left is false",
+			express:   "allow: Role('admin') or $quota < 10",
+			principal: &testPrincipal{roles: []string{"user"}},
+			params:    map[string]any{"quota": "unlimited"},
+			wantError: true,
+		},
+		{
+			name:      "And skips right side when left is false",
+			express:   "allow: Role('admin') and $tenant and true",
+			principal: &testPrincipal{roles: []string{"user"}},
+			params:    map[string]any{"tenant": "acme"},
+			expected:  false,
+		},
+		{
+			name:      "And evaluates right side when left is true",
+			express:   "allow: Role('admin') and $tenant",
+			principal: &testPrincipal{roles: []string{"admin"}},
+			params:    map[string]any{"tenant": "acme"},
+			wantError: true,
+		},
+		{
+			name:      "Left error is returned even if right side would decide",
+			express:   "allow: $quota < 10 or Role('admin')",
+			principal: &testPrincipal{roles: []string{"admin"}},
+			params:    map[string]any{"quota": "unlimited"},
+			wantError: true,
+		},
+		{
+			name:      "Non-bool left side is an error",
+			express:   "allow: $tenant or true",
+			principal: &testPrincipal{},
+			params:    map[string]any{"tenant": "acme"},
+			wantError: true,
+		},
+		{
+			name:      "Result comes from right side",
+			express:   "allow: Role('user') and $quota < 10",
+			principal: &testPrincipal{roles: []string{"user"}},
+			params:    map[string]any{"quota": 5},
+			expected:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.express)
+			if err != nil {
+				t.Fatalf("Failed to create guard: %v", err)
+			}
+
+			result, err := guard.Check(&SecurityContext{
+				Principal: tt.principal,
+				Params:    tt.params,
+			})
+			if tt.wantError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
 			}
 		})
 	}
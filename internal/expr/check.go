@@ -0,0 +1,132 @@
+package expr
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+)
+
+// $ / # 参数
+type param interface {
+	Param() (name string, isPlaceholder bool)
+}
+
+// 大小比较操作符，操作数需要是数字(或时间 / 时长)
+var relationalOperators = []string{"<", "<=", ">", ">="}
+
+// 创建 Guard 时的检查
+//
+// 表达式的结果必须可以是布尔值；defined 不为 nil 时检查 $ 参数是否都由端点提供，
+// defined 判断参数(如 userId / path.userId / 0)是否会由端点提供
+func (st *SyntaxTree) Check(defined func(name string) bool) ParseErrors {
+	errs := ParseErrors{}
+	if st.Syntax == nil {
+		// 只有策略，如 allow ，Guard 按策略直接放行或拒绝
+		return errs
+	}
+	if st.Syntax.ReturnType()&syntax.Type_Bool == 0 {
+		errs = append(errs, st.nodeError(CodeNonBoolean, "expression does not return a bool value", st.Syntax))
+	}
+	if defined == nil {
+		return errs
+	}
+	for node := range st.nodes {
+		p, ok := node.(param)
+		if !ok {
+			continue
+		}
+		name, isPlaceholder := p.Param()
+		if !isPlaceholder || defined(name) {
+			continue
+		}
+		msg := fmt.Sprintf("parameter \"$%s\" is not provided by the endpoint", name)
+		if !strings.Contains(name, ".") {
+			msg += fmt.Sprintf(", use $query.%s for query parameters not declared in the endpoint", name)
+		}
+		errs = append(errs, st.nodeError(CodeUndefinedParam, msg, node))
+	}
+	sortParseErrors(errs)
+	return errs
+}
+
+// 类型检查，找出永远不会成立的比较
+//
+// 只作为警告，不影响 Guard 的创建
+func (st *SyntaxTree) typeWarnings() ParseErrors {
+	warnings := ParseErrors{}
+	for node, info := range st.nodes {
+		if node.Kind() != 2 {
+			continue
+		}
+		operands := []syntax.Syntax{node.Left(), node.Right()}
+		switch {
+		case slices.Contains(relationalOperators, info.operator):
+			for _, operand := range operands {
+				if reason, ok := st.notNumber(operand); ok {
+					warnings = append(warnings, st.nodeError(CodeIncomparableTypes, fmt.Sprintf("comparison \"%s\" can never succeed, %s", info.operator, reason), node))
+					break
+				}
+			}
+		case info.operator == "==" || info.operator == "!=":
+			// 与 null 比较，另一方却不可能为 null
+			for i, operand := range operands {
+				other := operands[1-i]
+				if isNullConstant(operand) && other.ReturnType()&syntax.Type_Null == 0 {
+					warnings = append(warnings, st.nodeError(CodeIncomparableTypes, fmt.Sprintf("\"%s\" can never be null", st.text(other)), node))
+					break
+				}
+			}
+		}
+	}
+	sortParseErrors(warnings)
+	return warnings
+}
+
+// 操作数不可能是数字时返回原因
+func (st *SyntaxTree) notNumber(s syntax.Syntax) (string, bool) {
+	if constant, ok := s.(syntax.Constant); ok {
+		switch val := constant.Constant().(type) {
+		case bool:
+			return fmt.Sprintf("\"%s\" is not a number", st.text(s)), true
+		case string:
+			if _, err := cast.ToFloat64E(val); err != nil {
+				return fmt.Sprintf("\"%s\" is not a number", st.text(s)), true
+			}
+		}
+		return "", false
+	}
+	if s.ReturnType() == syntax.Type_Bool {
+		return fmt.Sprintf("\"%s\" returns bool", st.text(s)), true
+	}
+	return "", false
+}
+
+func isNullConstant(s syntax.Syntax) bool {
+	constant, ok := s.(syntax.Constant)
+	return ok && constant.Constant() == nil
+}
+
+// 节点对应的表达式片段
+func (st *SyntaxTree) text(node syntax.Syntax) string {
+	span := st.nodes[node].span
+	return st.input[span.Start:span.End]
+}
+
+// 指向节点的错误
+func (st *SyntaxTree) nodeError(code ParseErrorCode, msg string, node syntax.Syntax) *ParseError {
+	return newParseError(code, msg, st.text(node), st.nodes[node].span.Start, st.input)
+}
+
+// 按位置排序，位置相同时外层节点在前
+func sortParseErrors(errs ParseErrors) {
+	slices.SortStableFunc(errs, func(a, b *ParseError) int {
+		if a.Offset != b.Offset {
+			return a.Offset - b.Offset
+		}
+		return len(b.Token) - len(a.Token)
+	})
+}
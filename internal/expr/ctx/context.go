@@ -1,11 +1,45 @@
 package ctx
 
+import (
+	"maps"
+	"time"
+)
+
+// 参数来源命名空间
+//
+// endpoint 参数会同时以 "来源.参数名" 的形式写入 Params , 如 "path.userId" / "query.userId" / "wildcard.0"
+//
+// 不带来源的参数名按 path > wildcard > query 的优先级取值
+const (
+	ParamSourcePath     = "path"
+	ParamSourceQuery    = "query"
+	ParamSourceWildcard = "wildcard"
+)
+
+// 是否参数来源命名空间
+func IsParamSource(name string) bool {
+	switch name {
+	case ParamSourcePath, ParamSourceQuery, ParamSourceWildcard:
+		return true
+	}
+	return false
+}
+
 type Principal interface {
 	Id() string
 	Roles() []string
 	Permissions() []string
 	Groups() []string
 }
+
+// 带属性的"当事人"
+//
+// 表达式可以通过 principal.name 访问属性
+type AttributedPrincipal interface {
+	Principal
+	Attributes() map[string]any
+}
+
 type Context struct {
 	// "当事人"
 	Principal Principal
@@ -15,4 +49,49 @@ type Context struct {
 
 	// 自定义参数
 	CustomParams map[string]string
+
+	// 自定义参数，保留原始类型(数字、布尔、时间、嵌套对象等)，与 CustomParams 同名时优先
+	CustomValues map[string]any
+
+	// 时钟，now() 的取值，为 nil 时使用 time.Now ；测试时可以固定时间
+	Clock func() time.Time
+
+	// lambda 变量，如 any($tags, t -> t == 'a') 中的 t
+	locals map[string]any
+}
+
+// 返回绑定了 lambda 变量的新上下文，当前上下文不受影响
+func (c *Context) WithLocal(name string, v any) *Context {
+	next := *c
+	next.locals = maps.Clone(c.locals)
+	if next.locals == nil {
+		next.locals = map[string]any{}
+	}
+	next.locals[name] = v
+	return &next
+}
+
+// 自定义参数的值，CustomValues 优先于 CustomParams
+func (c *Context) Custom(name string) (any, bool) {
+	if v, ok := c.CustomValues[name]; ok {
+		return v, true
+	}
+	if v, ok := c.CustomParams[name]; ok {
+		return v, true
+	}
+	return nil, false
+}
+
+// 当前时间
+func (c *Context) Now() time.Time {
+	if c.Clock != nil {
+		return c.Clock()
+	}
+	return time.Now()
+}
+
+// lambda 变量的值
+func (c *Context) Local(name string) (any, bool) {
+	v, ok := c.locals[name]
+	return v, ok
 }
@@ -28,6 +28,12 @@ func printTreeNode(node syntax.Syntax, ident int) {
 
 	fmt.Printf("%s :Node: %s, Type: %d, Priority: %d\n", strings.Join(make([]string, ident), " "), typeName, typeKind, typePriority)
 
+	if operands, ok := node.(syntax.Operands); ok {
+		for _, operand := range operands.Operands() {
+			printTreeNode(operand, ident+1)
+		}
+	}
+
 	switch typeKind {
 	case 1:
 		printTreeNode(node.Left(), ident+1)
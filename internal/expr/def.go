@@ -11,7 +11,9 @@ type syntaxDef struct {
 
 	// token
 	Token *tokenizer.Token
-	// 优先级
+	// 操作符, 如 "not in" 由多个 token 组成
+	Operator string
+	// 优先级，数值越大结合越紧密
 	Priority int
 
 	// 参数数
@@ -28,7 +30,8 @@ func buildSyntaxDef(token *tokenizer.Token) (*syntaxDef, error) {
 		if token.ValueString() == "==" {
 			return &syntaxDef{
 				Token:    token,
-				Priority: 55,
+				Operator: token.ValueString(),
+				Priority: syntax.PrecedenceEquality,
 				Kind:     2,
 				Type:     syntax.Type_Bool | syntax.Type_String | syntax.Type_Number,
 			}, nil
@@ -36,14 +39,16 @@ func buildSyntaxDef(token *tokenizer.Token) (*syntaxDef, error) {
 		if token.ValueString() == "!=" {
 			return &syntaxDef{
 				Token:    token,
-				Priority: 55,
+				Operator: token.ValueString(),
+				Priority: syntax.PrecedenceEquality,
 				Kind:     2,
 				Type:     syntax.Type_Bool | syntax.Type_String | syntax.Type_Number,
 			}, nil
 		}
 		return &syntaxDef{
 			Token:    token,
-			Priority: 50,
+			Operator: token.ValueString(),
+			Priority: syntax.PrecedenceRelational,
 			Kind:     2,
 			Type:     syntax.Type_Bool | syntax.Type_Number,
 		}, nil
@@ -52,7 +57,8 @@ func buildSyntaxDef(token *tokenizer.Token) (*syntaxDef, error) {
 		if token.ValueString() == "+" || token.ValueString() == "-" {
 			return &syntaxDef{
 				Token:    token,
-				Priority: 35,
+				Operator: token.ValueString(),
+				Priority: syntax.PrecedenceAdditive,
 				Kind:     2,
 				Type:     syntax.Type_Number,
 			}, nil
@@ -60,22 +66,47 @@ func buildSyntaxDef(token *tokenizer.Token) (*syntaxDef, error) {
 		// * / %
 		return &syntaxDef{
 			Token:    token,
-			Priority: 30,
+			Operator: token.ValueString(),
+			Priority: syntax.PrecedenceMultiplicative,
 			Kind:     2,
 			Type:     syntax.Type_Number,
 		}, nil
 	} else if expectType(token, []tokenizer.TokenKey{TLogic}) {
 		// and or
+		priority := syntax.PrecedenceOr
+		if token.ValueString() == "and" {
+			priority = syntax.PrecedenceAnd
+		}
 		return &syntaxDef{
 			Token:    token,
-			Priority: 60,
+			Operator: token.ValueString(),
+			Priority: priority,
 			Kind:     2,
 			Type:     syntax.Type_Bool,
 		}, nil
+	} else if expectType(token, []tokenizer.TokenKey{TMembership}) {
+		// in / not in
+		return &syntaxDef{
+			Token:    token,
+			Operator: token.ValueString(),
+			Priority: syntax.PrecedenceEquality,
+			Kind:     2,
+			Type:     syntax.Type_Bool | syntax.Type_String | syntax.Type_Number | syntax.Type_Null,
+		}, nil
+	} else if expectType(token, []tokenizer.TokenKey{TCoalesce}) {
+		// ??
+		return &syntaxDef{
+			Token:    token,
+			Operator: token.ValueString(),
+			Priority: syntax.PrecedenceCoalesce,
+			Kind:     2,
+			Type:     syntax.Type_Bool | syntax.Type_String | syntax.Type_Number | syntax.Type_Null,
+		}, nil
 	} else if expectType(token, []tokenizer.TokenKey{TNegate}) {
 		return &syntaxDef{
 			Token:    token,
-			Priority: 20,
+			Operator: token.ValueString(),
+			Priority: syntax.PrecedenceNegate,
 			Kind:     1,
 			Type:     syntax.Type_Bool,
 		}, nil
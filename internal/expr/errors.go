@@ -0,0 +1,214 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+	"github.com/einsitang/go-security/internal/expr/tokenizer"
+)
+
+// 解析错误码
+type ParseErrorCode string
+
+const (
+	// 缺少 allow: / deny: 策略
+	CodeInvalidPolicy ParseErrorCode = "invalid_policy"
+	// 语法错误: 多余的 token、缺少操作数等
+	CodeSyntax ParseErrorCode = "syntax"
+	// 括号不匹配
+	CodeUnbalancedParen ParseErrorCode = "unbalanced_paren"
+	// 操作数类型不符合操作符要求
+	CodeMismatchedTypes ParseErrorCode = "mismatched_types"
+	// 函数参数个数、类型或取值错误
+	CodeInvalidArgument ParseErrorCode = "invalid_argument"
+	// 未知的函数
+	CodeUnknownFunction ParseErrorCode = "unknown_function"
+	// 错误的参数 / 当事人属性 / 访问路径
+	CodeInvalidReference ParseErrorCode = "invalid_reference"
+	// 错误的常量或列表
+	CodeInvalidLiteral ParseErrorCode = "invalid_literal"
+	// 表达式的结果不是布尔值
+	CodeNonBoolean ParseErrorCode = "non_boolean"
+	// 端点不会提供的 $ 参数
+	CodeUndefinedParam ParseErrorCode = "undefined_param"
+	// 比较的类型永远不会匹配，仅作为警告
+	CodeIncomparableTypes ParseErrorCode = "incomparable_types"
+)
+
+// 解析错误
+//
+// 位置信息指向出错的 token 或表达式片段的开始，表达式结束处出错时指向表达式末尾
+type ParseError struct {
+	// 错误码
+	Code ParseErrorCode
+	// 错误信息
+	Message string
+	// 出错的 token 或表达式片段，表达式结束处出错时为空
+	Token string
+	// 字节偏移，从 0 开始
+	Offset int
+	// 行号，从 1 开始
+	Line int
+	// 列号(按字符计算)，从 1 开始
+	Column int
+
+	// 原始表达式
+	Express string
+}
+
+func (e *ParseError) Error() string {
+	// 只输出出错的行
+	line := strings.Split(e.Express, "\n")[e.Line-1]
+	return fmt.Sprintf("[%d:%d] \"%s\": %s\n%s\n%s", e.Line, e.Column, e.Token, e.Message, line, tipsLine(line, e.Column))
+}
+
+// 一次解析中的全部错误，按出现顺序排列
+//
+// 可以用 errors.As 取出全部错误 (*ParseErrors) 或第一个错误 (**ParseError)
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (e ParseErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+func parseError(code ParseErrorCode, msg string, token *tokenizer.Token, input string) *ParseError {
+	if !token.IsValid() {
+		return newParseError(code, msg, "", len(input), input)
+	}
+	return newParseError(code, msg, token.ValueString(), token.Offset(), input)
+}
+
+func newParseError(code ParseErrorCode, msg string, value string, offset int, input string) *ParseError {
+	lineStart := strings.LastIndex(input[:offset], "\n") + 1
+	return &ParseError{
+		Code:    code,
+		Message: msg,
+		Token:   value,
+		Offset:  offset,
+		Line:    strings.Count(input[:offset], "\n") + 1,
+		Column:  utf8.RuneCountInString(input[lineStart:offset]) + 1,
+		Express: input,
+	}
+}
+
+// 在出错的列下方标注 ^
+func tipsLine(line string, column int) string {
+	after := utf8.RuneCountInString(line) - column
+	return strings.Repeat("-", column-1) + "^" + strings.Repeat("-", max(after, 0))
+}
+
+// 一次解析的状态
+type parseState struct {
+	// 原始表达式
+	input string
+	// 节点位置信息
+	nodes map[syntax.Syntax]nodeInfo
+	// 已记录的错误
+	errs ParseErrors
+	// 十进制模式
+	decimal bool
+	// 严格类型模式
+	strictTypes bool
+	// 参数不存在时返回错误
+	missingParamError bool
+	// 当前可见的 lambda 变量，值为嵌套层数
+	locals map[string]int
+}
+
+// 是否 lambda 变量
+func (state *parseState) isLocal(token *tokenizer.Token) bool {
+	return expectType(token, []tokenizer.TokenKey{tokenizer.TokenKeyword}) && state.locals[token.ValueString()] > 0
+}
+
+// 记录错误，不是解析错误时返回 false , 此时无法继续解析
+func (state *parseState) report(err error) bool {
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		return false
+	}
+	state.errs = append(state.errs, parseErr)
+	return true
+}
+
+// 记录错误并返回占位节点，用于类型不符、参数错误等不影响后续解析的错误
+func (state *parseState) invalid(err error) syntax.Syntax {
+	state.report(err)
+	return &invalidSyntax{err: err}
+}
+
+// 出错位置的占位节点，使解析可以继续并报告后续的错误
+//
+// 可以作为任意类型的操作数，避免引起连锁的类型错误；出错时不会返回语法树，因此不会被求值
+type invalidSyntax struct {
+	err error
+}
+
+// 语句优先级
+func (s *invalidSyntax) Priority() int {
+	return 100
+}
+
+// 操作符支持参数个数 一元操作符为1，二元操作符为2
+func (s *invalidSyntax) Kind() int {
+	return 0
+}
+
+// 入参类型要求
+func (s *invalidSyntax) InputType() int {
+	return 0
+}
+
+// 支持的出参类型,具体结果得执行 Evaluate 运行后得出
+func (s *invalidSyntax) ReturnType() int {
+	return syntax.Type_Bool | syntax.Type_Number | syntax.Type_String | syntax.Type_List | syntax.Type_Time | syntax.Type_Duration
+}
+
+func (s *invalidSyntax) Left() syntax.Syntax {
+	panic("Syntax not support left value")
+}
+
+func (s *invalidSyntax) Right() syntax.Syntax {
+	panic("Syntax not support right value")
+}
+
+func (s *invalidSyntax) ChangeLeft(left syntax.Syntax) {
+	panic("Syntax not support left value")
+}
+
+func (s *invalidSyntax) ChangeRight(right syntax.Syntax) {
+	panic("Syntax not support right value")
+}
+
+// 运行求值
+func (s *invalidSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
+	return syntax.SyntaxValue{
+		IsError: true,
+		Error:   s.err,
+	}
+}
+
+// 参数中是否有出错的节点
+func hasInvalid(args []syntax.Syntax) bool {
+	for _, arg := range args {
+		if _, ok := arg.(*invalidSyntax); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -2,10 +2,15 @@ package expr
 
 import (
 	"fmt"
+	"maps"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/einsitang/go-security/internal/expr/ctx"
 	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+	"github.com/einsitang/go-security/internal/expr/snytax/function"
 	"github.com/einsitang/go-security/internal/expr/snytax/oper"
 	"github.com/einsitang/go-security/internal/expr/snytax/value"
 	"github.com/einsitang/go-security/internal/expr/tokenizer"
@@ -27,34 +32,97 @@ const (
 	TPlaceholder
 	TCustomParam
 	TComma
+	TBool
+	TNull
+	TBracketOpen
+	TBracketClose
+	TMembership
+	TPrincipal
+	TCoalesce
+	TArrow
 )
 
 type syntaxAnalyzer struct {
 	lexer *tokenizer.Tokenizer
+	// 函数表, 通过 TBuiltinFunction 调用
+	functions map[string]*function.Func
+	// Permission / Permissions 按通配符权限匹配
+	wildcardPermission bool
+	// 非 nil 时 Role / Roles 按角色继承匹配
+	roleHierarchy *value.RoleHierarchy
+	// 数值运算 / 比较按十进制精确计算
+	decimal bool
+	// 比较两侧类型不同时返回错误
+	strictTypes bool
+	// 参数不存在时返回错误
+	missingParamError bool
 }
 
 type SyntaxTree struct {
 	Policy string
 	Syntax syntax.Syntax
+	// 类型检查的警告，如永远不会成立的比较
+	Warnings ParseErrors
+
+	// 原始表达式
+	input string
+	// 节点位置信息，用于 Explain
+	nodes map[syntax.Syntax]nodeInfo
 }
 
 type SyntaxAnalyzer interface {
 	Parse(input string) (*SyntaxTree, error)
+
+	// 返回注册了 functions 的新解析器，当前解析器不受影响
+	WithFunctions(functions ...*function.Func) (SyntaxAnalyzer, error)
+
+	// 返回 Permission / Permissions 按通配符权限(domain:action:instance)匹配的新解析器，当前解析器不受影响
+	WithWildcardPermission() SyntaxAnalyzer
+
+	// 返回 Role / Roles 按角色继承匹配的新解析器，hierarchy 为 nil 时取消角色继承，当前解析器不受影响
+	WithRoleHierarchy(hierarchy *value.RoleHierarchy) SyntaxAnalyzer
+
+	// 返回数值运算 / 比较按十进制精确计算的新解析器(如 0.1 + 0.2 == 0.3)，当前解析器不受影响
+	WithDecimal() SyntaxAnalyzer
+
+	// 返回比较两侧类型不同时返回错误的新解析器(如 $id 为 '1' 时的 $id == 1)，当前解析器不受影响
+	WithStrictTypes() SyntaxAnalyzer
+
+	// 返回引用不存在的参数时返回错误的新解析器(exists / has / ?? 不受影响)，当前解析器不受影响
+	WithMissingParamError() SyntaxAnalyzer
 }
 
 func NewAnalyzer() *syntaxAnalyzer {
+	functions := map[string]*function.Func{}
+	for _, fn := range slices.Concat(function.StringFuncs(), function.PrincipalFuncs(), function.TimeFuncs()) {
+		functions[fn.Name] = fn
+	}
+	return newAnalyzer(functions)
+}
+
+func newAnalyzer(functions map[string]*function.Func) *syntaxAnalyzer {
 
 	_tokenizer := tokenizer.New()
-	_tokenizer.DefineTokens(TPolicy, []string{"allow", "deny"}) // Policy
+	_tokenizer.DefineTokens(TPolicy, []string{"allow", "deny"}, tokenizer.AloneTokenOption) // Policy
+	_tokenizer.DefineTokens(TBool, []string{"true", "false"}, tokenizer.AloneTokenOption)
+	_tokenizer.DefineTokens(TNull, []string{"null"}, tokenizer.AloneTokenOption)
+	_tokenizer.DefineTokens(TPrincipal, []string{"principal"}, tokenizer.AloneTokenOption)
 	_tokenizer.DefineTokens(TBuiltinFunction, []string{
 		"Role", "Permission", "Group", "Roles", "Permissions", "Groups",
+		"AllRoles", "AllPermissions", "AllGroups", "AtLeast", "exists", "has", "any", "all",
 	}, tokenizer.AloneTokenOption) // 内置单元函数
+	_tokenizer.DefineTokens(TBuiltinFunction, slices.Sorted(maps.Keys(functions)), tokenizer.AloneTokenOption) // 函数表
 	_tokenizer.DefineTokens(TCurlyOpen, []string{"("})
 	_tokenizer.DefineTokens(TCurlyClose, []string{")"})
-	_tokenizer.DefineTokens(TNegate, []string{"!"})                                  // 逻辑运算符 单元
-	_tokenizer.DefineTokens(TMath, []string{"+", "-", "/", "*", "%"})                // 运算符 双元
-	_tokenizer.DefineTokens(TComparison, []string{"<", "<=", ">=", ">", "==", "!="}) // 逻辑运算符 双元
-	_tokenizer.DefineTokens(TLogic, []string{"and", "or"})                           // 逻辑符 双元
+	_tokenizer.DefineTokens(TNegate, []string{"!"})                                         // 逻辑运算符 单元
+	_tokenizer.DefineTokens(TMath, []string{"+", "-", "/", "*", "%"})                       // 运算符 双元
+	_tokenizer.DefineTokens(TComparison, []string{"<", "<=", ">=", ">", "==", "!="})        // 逻辑运算符 双元
+	_tokenizer.DefineTokens(TLogic, []string{"and", "or"}, tokenizer.AloneTokenOption)      // 逻辑符 双元
+	_tokenizer.DefineTokens(TMembership, []string{"in", "not"}, tokenizer.AloneTokenOption) // in / not in 双元
+	_tokenizer.DefineTokens(TCoalesce, []string{"??"})                                      // null 合并 双元
+	_tokenizer.DefineTokens(TArrow, []string{"->"})                                         // lambda
+	_tokenizer.DefineTokens(TBracketOpen, []string{"["})
+	_tokenizer.DefineTokens(TBracketClose, []string{"]"})
 	_tokenizer.DefineTokens(TDot, []string{"."})
 	_tokenizer.DefineTokens(TComma, []string{","})
 	_tokenizer.DefineStringToken(TDoubleQuoted, `"`, `"`)
@@ -64,9 +132,75 @@ func NewAnalyzer() *syntaxAnalyzer {
 	_tokenizer.AllowKeywordSymbols(tokenizer.Underscore, tokenizer.Numbers)
 
 	return &syntaxAnalyzer{
-		lexer: _tokenizer,
+		lexer:     _tokenizer,
+		functions: functions,
+	}
+
+}
+
+var functionNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (analyzer *syntaxAnalyzer) WithFunctions(functions ...*function.Func) (SyntaxAnalyzer, error) {
+	next := maps.Clone(analyzer.functions)
+	for _, fn := range functions {
+		if !functionNamePattern.MatchString(fn.Name) {
+			return nil, fmt.Errorf("invalid function name \"%s\"", fn.Name)
+		}
+		// 只有不会被识别成关键字/内置函数的名字才可以注册
+		if !analyzer.isPlainKeyword(fn.Name) || next[fn.Name] != nil {
+			return nil, fmt.Errorf("function name \"%s\" is reserved or already registered", fn.Name)
+		}
+		next[fn.Name] = fn
 	}
+	return analyzer.clone(next), nil
+}
+
+func (analyzer *syntaxAnalyzer) WithWildcardPermission() SyntaxAnalyzer {
+	_analyzer := analyzer.clone(analyzer.functions)
+	_analyzer.wildcardPermission = true
+	return _analyzer
+}
+
+func (analyzer *syntaxAnalyzer) WithRoleHierarchy(hierarchy *value.RoleHierarchy) SyntaxAnalyzer {
+	_analyzer := analyzer.clone(analyzer.functions)
+	_analyzer.roleHierarchy = hierarchy
+	return _analyzer
+}
+
+func (analyzer *syntaxAnalyzer) WithDecimal() SyntaxAnalyzer {
+	_analyzer := analyzer.clone(analyzer.functions)
+	_analyzer.decimal = true
+	return _analyzer
+}
 
+func (analyzer *syntaxAnalyzer) WithStrictTypes() SyntaxAnalyzer {
+	_analyzer := analyzer.clone(analyzer.functions)
+	_analyzer.strictTypes = true
+	return _analyzer
+}
+
+func (analyzer *syntaxAnalyzer) WithMissingParamError() SyntaxAnalyzer {
+	_analyzer := analyzer.clone(analyzer.functions)
+	_analyzer.missingParamError = true
+	return _analyzer
+}
+
+// 使用新的函数表创建解析器，保留其它选项
+func (analyzer *syntaxAnalyzer) clone(functions map[string]*function.Func) *syntaxAnalyzer {
+	_analyzer := newAnalyzer(functions)
+	_analyzer.wildcardPermission = analyzer.wildcardPermission
+	_analyzer.roleHierarchy = analyzer.roleHierarchy
+	_analyzer.decimal = analyzer.decimal
+	_analyzer.strictTypes = analyzer.strictTypes
+	_analyzer.missingParamError = analyzer.missingParamError
+	return _analyzer
+}
+
+// 是否普通关键字(非保留字)
+func (analyzer *syntaxAnalyzer) isPlainKeyword(name string) bool {
+	stream := analyzer.lexer.ParseString(name)
+	defer stream.Close()
+	return expectType(stream.CurrentToken(), []tokenizer.TokenKey{tokenizer.TokenKeyword}) && !stream.NextToken().IsValid()
 }
 
 func (analyzer *syntaxAnalyzer) Parse(input string) (*SyntaxTree, error) {
@@ -89,272 +223,653 @@ func (analyzer *syntaxAnalyzer) Parse(input string) (*SyntaxTree, error) {
 			}
 			if !expectStringValue(next.CurrentToken(), []string{":"}) {
 				// 出错了,如果有后续必须是:
-				return nil, fmt.Errorf("\"%s\" expect next token must \":\" or EOF", token.ValueString())
+				return nil, ParseErrors{parseError(CodeInvalidPolicy, fmt.Sprintf("\"%s\" expect next token must \":\" or EOF", token.ValueString()), next.CurrentToken(), input)}
 			}
 			stream.GoNext()
-			_syntax, err := parseWithScope(stream, 0, input)
+			state := &parseState{input: input, nodes: map[syntax.Syntax]nodeInfo{}, locals: map[string]int{}, decimal: analyzer.decimal, strictTypes: analyzer.strictTypes, missingParamError: analyzer.missingParamError}
+			_syntax, err := analyzer.parseWithScope(stream, 0, state)
 			if err != nil {
 				return nil, err
 			}
-			return &SyntaxTree{Policy: policy, Syntax: _syntax}, nil
+			if len(state.errs) > 0 {
+				// 恢复解析时内层的错误可能先于外层记录
+				sortParseErrors(state.errs)
+				return nil, state.errs
+			}
+			st := &SyntaxTree{Policy: policy, Syntax: _syntax, input: input, nodes: state.nodes}
+			st.Warnings = st.typeWarnings()
+			return st, nil
 		}
 
-		return nil, parseError("express must begin with \"Policy\" like: `allow:` or `deny:` ", token, stream, input)
+		return nil, ParseErrors{parseError(CodeInvalidPolicy, "express must begin with \"Policy\" like: `allow:` or `deny:` ", token, input)}
 	}
-	return nil, parseError("there are some errors with express", stream.CurrentToken(), stream, input)
+	return nil, ParseErrors{parseError(CodeSyntax, "there are some errors with express", stream.CurrentToken(), input)}
 }
 
-func parseWithScope(stream *tokenizer.Stream, scope int, input string) (syntax.Syntax, error) {
-	// 子句 statementStack
-	syntaxStatementStack := []syntax.Syntax{}
-	// syntax def
-	cacheOperTokens := []*syntaxDef{}
-
-	for stream.IsValid() {
-		token := stream.CurrentToken()
-		// fmt.Printf("[DEBUG] %d:%d %s \n", token.Line(), token.Offset(), token.ValueString())
-
-		// 括号开辟新空间
-		// (
-		if expectType(token, []tokenizer.TokenKey{TCurlyOpen}) {
-			// (
-			stream.GoNext()
-			s, err := parseWithScope(stream, scope+1, input)
-			if err != nil {
+// 表达式解析
+//
+// scope > 0 时(括号或函数参数内) 在 ")" 或 "," 处结束，stream 停在结束的 token 上
+//
+// 出错时记录错误，跳过出错的部分后继续解析，以便一次报告全部错误
+func (analyzer *syntaxAnalyzer) parseWithScope(stream *tokenizer.Stream, scope int, state *parseState) (syntax.Syntax, error) {
+	_syntax, err := analyzer.parseExpression(stream, 0, scope, state)
+	for {
+		if err != nil {
+			if !state.report(err) {
 				return nil, err
 			}
-			syntaxStatementStack = append(syntaxStatementStack, s)
-		} else if expectType(token, []tokenizer.TokenKey{TCurlyClose}) {
-			// )
-			if scope == 0 {
-				return nil, parseError("没有找到 \"(\" , 无法解析 \")\"", token, stream, input)
-			}
-			// 结束，合并语法树，跳出当前循环
-
-			// stream to next
-			// stream.GoNext()
-			break
-
-		} else if expectValueToken(token) {
-			// 值语法处理
-			_syntax, err := valueSyntaxParse(token, stream, input)
-			if err != nil {
-				return nil, err
+			start := state.errs[len(state.errs)-1].Offset
+			skipInvalid(stream, scope)
+			end := len(state.input)
+			if stream.IsValid() {
+				end = stream.CurrentToken().Offset()
 			}
+			// 以占位节点代替出错的部分，继续解析后续的 and / or
+			_syntax = &invalidSyntax{err: err}
+			state.nodes[_syntax] = nodeInfo{span: Span{Start: min(start, end), End: end}}
+			_syntax, err = analyzer.parseInfix(stream, _syntax, 0, scope, state)
+			continue
+		}
 
-			syntaxStatementStack = append(syntaxStatementStack, _syntax)
+		if !stream.IsValid() {
+			return _syntax, nil
+		}
+		token := stream.CurrentToken()
+		if scope > 0 && expectType(token, []tokenizer.TokenKey{TCurlyClose, TComma}) {
+			return _syntax, nil
+		}
+		if expectType(token, []tokenizer.TokenKey{TCurlyClose}) {
+			err = parseError(CodeUnbalancedParen, "syntax error, \")\" without \"(\"", token, state.input)
 		} else {
-			// 操作语法处理
-			// > >= == != < <= +-*/% and or !
-			tokenDef, err := buildSyntaxDef(token)
-			if err != nil {
-				return nil, parseError(err.Error(), token, stream, input)
-			}
-			cacheOperTokens = append(cacheOperTokens, tokenDef)
+			err = parseError(CodeSyntax, fmt.Sprintf("syntax error, unexpected \"%s\"", token.ValueString()), token, state.input)
 		}
-		stream.GoNext()
 	}
-	// 聚合解析 cacheOperTokens 与 syntaxStatementStack
-	return mergeAnalysis(cacheOperTokens, syntaxStatementStack, stream, input)
 }
 
-func pickPriorityOperToken(cacheOperTokens []*syntaxDef) (int, *syntaxDef) {
-	var operTokenPosition int
-	var currentOperToken *syntaxDef
-	for i, tokenDef := range cacheOperTokens {
-		if currentOperToken == nil {
-			currentOperToken = tokenDef
-			operTokenPosition = i
-		} else {
-			if currentOperToken.Priority > tokenDef.Priority {
-				currentOperToken = tokenDef
-				operTokenPosition = i
+// 跳过出错的部分
+//
+// 到同一层的 and / or 为止, scope > 0 时还会停在 ")" 或 "," ；括号内的 token 全部跳过
+func skipInvalid(stream *tokenizer.Stream, scope int) {
+	depth := 0
+	for ; stream.IsValid(); stream.GoNext() {
+		token := stream.CurrentToken()
+		switch {
+		case expectType(token, []tokenizer.TokenKey{TCurlyOpen, TBracketOpen}):
+			depth++
+		case depth > 0 && expectType(token, []tokenizer.TokenKey{TCurlyClose, TBracketClose}):
+			depth--
+		case depth > 0:
+		case expectType(token, []tokenizer.TokenKey{TLogic}):
+			return
+		case scope > 0 && expectType(token, []tokenizer.TokenKey{TCurlyClose, TComma}):
+			return
+		}
+	}
+}
+
+// 优先级爬升(Pratt) 解析
+//
+// 只合并优先级高于 minPriority 的双元操作符，同级操作符因此左结合: a - b - c => (a - b) - c
+//
+// 优先级见 buildSyntaxDef
+func (analyzer *syntaxAnalyzer) parseExpression(stream *tokenizer.Stream, minPriority int, scope int, state *parseState) (syntax.Syntax, error) {
+	left, err := analyzer.parsePrefix(stream, scope, state)
+	if err != nil {
+		return nil, err
+	}
+	return analyzer.parseInfix(stream, left, minPriority, scope, state)
+}
+
+// 以 left 为左值，继续合并之后的双元操作符
+func (analyzer *syntaxAnalyzer) parseInfix(stream *tokenizer.Stream, left syntax.Syntax, minPriority int, scope int, state *parseState) (syntax.Syntax, error) {
+	for stream.IsValid() {
+		token := stream.CurrentToken()
+		if expectType(token, []tokenizer.TokenKey{TCurlyClose, TComma}) {
+			// 由 parseWithScope 检查
+			break
+		}
+
+		def, err := buildSyntaxDef(token)
+		if err != nil || def.Kind != 2 {
+			return nil, parseError(CodeSyntax, fmt.Sprintf("syntax error, expect operator but got \"%s\"", token.ValueString()), token, state.input)
+		}
+		if def.Operator == "not" {
+			// not in
+			if !expectStringValue(stream.NextToken(), []string{"in"}) {
+				return nil, parseError(CodeSyntax, "syntax error, \"not\" must with \"in\"", token, state.input)
 			}
+			def.Operator = "not in"
+		}
+		if def.Priority <= minPriority {
+			break
+		}
+		if def.Operator == "not in" {
+			stream.GoNext()
+		}
+		stream.GoNext()
+
+		right, err := analyzer.parseExpression(stream, def.Priority, scope, state)
+		if err != nil {
+			return nil, err
+		}
+		if left, err = binarySyntaxBuild(def, left, right, stream, state); err != nil {
+			return nil, err
 		}
 	}
-	return operTokenPosition, currentOperToken
+	return left, nil
 }
-func mergeAnalysis(cacheOperTokens []*syntaxDef, syntaxStatementStack []syntax.Syntax, stream *tokenizer.Stream, input string) (syntax.Syntax, error) {
 
-	for len(cacheOperTokens) > 0 {
-		operPosition, operToken := pickPriorityOperToken(cacheOperTokens)
+// 前缀表达式: 值、括号、一元操作符 !
+func (analyzer *syntaxAnalyzer) parsePrefix(stream *tokenizer.Stream, scope int, state *parseState) (syntax.Syntax, error) {
+	token := stream.CurrentToken()
+	if !stream.IsValid() || expectType(token, []tokenizer.TokenKey{TCurlyClose, TComma}) {
+		return nil, parseError(CodeSyntax, "syntax error, expect expression", token, state.input)
+	}
 
-		_syntax, err := operSyntaxParse(operToken.Token, stream, input)
+	// 括号开辟新空间
+	if expectType(token, []tokenizer.TokenKey{TCurlyOpen}) {
+		start := token.Offset()
+		stream.GoNext()
+		s, err := analyzer.parseWithScope(stream, scope+1, state)
 		if err != nil {
 			return nil, err
 		}
+		if !expectType(stream.CurrentToken(), []tokenizer.TokenKey{TCurlyClose}) {
+			return nil, parseError(CodeUnbalancedParen, "syntax error, \"(\" must with \")\"", token, state.input)
+		}
+		// 括号语句的位置包含括号本身
+		info := state.nodes[s]
+		info.span = Span{Start: start, End: tokenEnd(stream.CurrentToken(), state.input)}
+		state.nodes[s] = info
+		stream.GoNext()
+		return s, nil
+	}
 
-		switch operToken.Kind {
-		case 1:
-			// 单元
-			v := syntaxStatementStack[operPosition]
-			if v.ReturnType()&_syntax.InputType() == 0 {
-				return nil, parseError("mismatched types", operToken.Token, stream, input)
-			}
-			_syntax.ChangeLeft(v)
+	// 值语法处理
+	if expectValueToken(token) || state.isLocal(token) {
+		start := token.Offset()
+		operator := ""
+		if expectType(token, []tokenizer.TokenKey{TBuiltinFunction}) {
+			operator = token.ValueString()
+		}
+		_syntax, err := analyzer.valueSyntaxParse(token, stream, state)
+		if err != nil {
+			return nil, err
+		}
+		state.nodes[_syntax] = nodeInfo{
+			span:     Span{Start: start, End: tokenEnd(stream.CurrentToken(), state.input)},
+			operator: operator,
+		}
+		stream.GoNext()
+		return _syntax, nil
+	}
 
-			syntaxStatementStack[operPosition] = _syntax
+	// 未注册的函数
+	if expectType(token, []tokenizer.TokenKey{tokenizer.TokenKeyword}) && expectType(stream.NextToken(), []tokenizer.TokenKey{TCurlyOpen}) {
+		return nil, parseError(CodeUnknownFunction, fmt.Sprintf("unknown function \"%s\"", token.ValueString()), token, state.input)
+	}
 
-		case 2:
-			// 双元
-			left := syntaxStatementStack[operPosition]
-			right := syntaxStatementStack[operPosition+1]
-			if left.ReturnType()&right.ReturnType()&_syntax.InputType() == 0 {
-				return nil, parseError("mismatched types", operToken.Token, stream, input)
-			}
-			_syntax.ChangeLeft(left)
-			_syntax.ChangeRight(right)
-			_n := append(syntaxStatementStack[:operPosition], _syntax)
-			_n = append(_n, syntaxStatementStack[operPosition+2:]...)
-			syntaxStatementStack = _n
+	// 一元操作符 !
+	def, err := buildSyntaxDef(token)
+	if err != nil || def.Kind != 1 {
+		return nil, parseError(CodeSyntax, fmt.Sprintf("syntax error, expect expression but got \"%s\"", token.ValueString()), token, state.input)
+	}
+	stream.GoNext()
+	v, err := analyzer.parseExpression(stream, def.Priority, scope, state)
+	if err != nil {
+		return nil, err
+	}
+	_syntax, err := operSyntaxParse(def, stream, state.input)
+	if err != nil {
+		return nil, err
+	}
+	if v.ReturnType()&_syntax.InputType() == 0 {
+		_syntax = state.invalid(parseError(CodeMismatchedTypes, "mismatched types", def.Token, state.input))
+	} else {
+		_syntax.ChangeLeft(v)
+	}
+	state.nodes[_syntax] = nodeInfo{
+		span:     Span{Start: def.Token.Offset(), End: state.nodes[v].span.End},
+		operator: def.Operator,
+	}
+	return _syntax, nil
+}
+
+// 创建双元操作语句并检查左右值类型
+func binarySyntaxBuild(def *syntaxDef, left, right syntax.Syntax, stream *tokenizer.Stream, state *parseState) (syntax.Syntax, error) {
+	_syntax, err := operSyntaxParse(def, stream, state.input)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := _syntax.(oper.Decimal); ok && state.decimal {
+		d.SetDecimal()
+	}
+	if st, ok := _syntax.(oper.StrictTypes); ok && state.strictTypes {
+		st.SetStrictTypes()
+	}
+	if typed, ok := _syntax.(rightTyped); ok {
+		// 左右值类型要求不同, 如 in 的右值必须是列表
+		if left.ReturnType()&_syntax.InputType() == 0 || right.ReturnType()&typed.RightInputType() == 0 {
+			_syntax = state.invalid(parseError(CodeMismatchedTypes, "mismatched types", def.Token, state.input))
 		}
-		cacheOperTokens = append(cacheOperTokens[:operPosition], cacheOperTokens[operPosition+1:]...)
+	} else if typed, ok := _syntax.(operandTyped); ok {
+		// 左右值类型组合由操作符决定, 如 时间 - 时长
+		if !typed.AcceptTypes(left.ReturnType(), right.ReturnType()) {
+			_syntax = state.invalid(parseError(CodeMismatchedTypes, "mismatched types", def.Token, state.input))
+		}
+	} else if !binaryTypeMatch(left.ReturnType(), right.ReturnType(), _syntax.InputType()) {
+		_syntax = state.invalid(parseError(CodeMismatchedTypes, "mismatched types", def.Token, state.input))
+	}
+	if _, ok := _syntax.(*invalidSyntax); !ok {
+		_syntax.ChangeLeft(left)
+		_syntax.ChangeRight(right)
 	}
+	state.nodes[_syntax] = nodeInfo{
+		span:     Span{Start: state.nodes[left].span.Start, End: state.nodes[right].span.End},
+		operator: def.Operator,
+	}
+	return _syntax, nil
+}
 
-	return syntaxStatementStack[0], nil
+// 左右值类型要求不同的双元操作符
+type rightTyped interface {
+	RightInputType() int
+}
+
+// 自行检查左右值类型组合的双元操作符
+type operandTyped interface {
+	AcceptTypes(left, right int) bool
+}
 
+// 双元操作符类型检查
+//
+// 左右值类型需要有交集并且被操作符接受, null 可以与任意类型比较(由操作符是否接受 null 决定)
+func binaryTypeMatch(left, right, input int) bool {
+	if left == syntax.Type_Null || right == syntax.Type_Null {
+		return input&syntax.Type_Null != 0 && left&input != 0 && right&input != 0
+	}
+	return left&right&input != 0
 }
 
 // 内置函数语法解析器
-func builtinFunctionParse(token *tokenizer.Token, stream *tokenizer.Stream, input string) (syntax.Syntax, error) {
+func (analyzer *syntaxAnalyzer) builtinFunctionParse(token *tokenizer.Token, stream *tokenizer.Stream, state *parseState) (syntax.Syntax, error) {
+
+	if fn, ok := analyzer.functions[token.ValueString()]; ok {
+		return analyzer.functionCallParse(fn, token, stream, state)
+	}
 
 	switch token.ValueString() {
 	case "Role", "Permission", "Group":
-		return singleVarBuiltinFunctionParse(token, stream, input)
-	case "Roles", "Permissions", "Groups":
-		return multiVarBuiltinFunctionParse(token, stream, input)
+		return analyzer.singleVarBuiltinFunctionParse(token, stream, state)
+	case "Roles", "Permissions", "Groups", "AllRoles", "AllPermissions", "AllGroups":
+		return analyzer.multiVarBuiltinFunctionParse(token, stream, state)
+	case "AtLeast":
+		return analyzer.atLeastParse(token, stream, state)
+	case "exists", "has":
+		return analyzer.existsParse(token, stream, state)
+	case "any", "all":
+		return analyzer.quantifierParse(token, stream, state)
 	}
 
-	return nil, parseError("unknow builtin function", token, stream, input)
+	return nil, parseError(CodeUnknownFunction, "unknown builtin function", token, state.input)
 }
 
-func arrayParamsParse(token *tokenizer.Token, stream *tokenizer.Stream, input string) ([]string, error) {
-	values := []string{}
+// 函数调用解析器
+//
+// 参数可以是任意表达式，参数个数与类型在解析时检查
+func (analyzer *syntaxAnalyzer) functionCallParse(fn *function.Func, token *tokenizer.Token, stream *tokenizer.Stream, state *parseState) (syntax.Syntax, error) {
+	args, err := analyzer.argsParse(token, stream, state)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasInvalid(args) {
+		// 参数已经报告过错误
+		return &invalidSyntax{}, nil
+	}
+	_syntax, err := function.NewFuncSyntax(fn, args, state.decimal, state.strictTypes)
+	if err != nil {
+		return state.invalid(parseError(CodeInvalidArgument, err.Error(), token, state.input)), nil
+	}
+	return _syntax, nil
+}
+
+// 参数列表解析器 ( arg1, arg2, ... )
+//
+// 参数可以是任意表达式，结束时 stream 停在 ")"
+func (analyzer *syntaxAnalyzer) argsParse(token *tokenizer.Token, stream *tokenizer.Stream, state *parseState) ([]syntax.Syntax, error) {
 	curlyOpen := stream.GoNext().CurrentToken()
 	// must with (
 	if !expectType(curlyOpen, []tokenizer.TokenKey{TCurlyOpen}) {
-		return nil, parseError(fmt.Sprintf("syntax error, %s must with \"(\"", token.ValueString()), token, stream, input)
+		return nil, parseError(CodeSyntax, fmt.Sprintf("syntax error, %s must with \"(\"", token.ValueString()), token, state.input)
 	}
 
-	// Looking forward to the comma ?
-	lookForComma := false
-	nextToken := stream.GoNext().CurrentToken()
-	for nextToken.IsValid() {
-
-		if !lookForComma && expectType(nextToken, []tokenizer.TokenKey{tokenizer.TokenString}) {
-			// String Constant
-			lookForComma = true
-			val := nextToken.ValueString()
-			val = strings.Trim(val, "'")
-			val = strings.Trim(val, "\"")
-			values = append(values, val)
-		} else if lookForComma && expectType(nextToken, []tokenizer.TokenKey{TComma}) {
-			// comma
-			lookForComma = false
-		} else {
-			// 括号结束
-			break
-		}
-		nextToken = stream.GoNext().CurrentToken()
+	args := []syntax.Syntax{}
+	if expectType(stream.NextToken(), []tokenizer.TokenKey{TCurlyClose}) {
+		// 无参数
+		stream.GoNext()
+		return args, nil
 	}
+	for {
+		stream.GoNext()
+		arg, err := analyzer.parseWithScope(stream, 1, state)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
 
-	curlyClose := stream.CurrentToken()
-	// must with )
-	if !expectType(curlyClose, []tokenizer.TokenKey{TCurlyClose}) {
-		return nil, parseError(fmt.Sprintf("syntax error, %s must with \")\" but meet \"%s\"", token.ValueString(), curlyClose.ValueString()), token, stream, input)
+		next := stream.CurrentToken()
+		if expectType(next, []tokenizer.TokenKey{TCurlyClose}) {
+			return args, nil
+		}
+		if !expectType(next, []tokenizer.TokenKey{TComma}) {
+			return nil, parseError(CodeUnbalancedParen, fmt.Sprintf("syntax error, %s must with \")\"", token.ValueString()), token, state.input)
+		}
 	}
+}
 
-	if len(values) == 0 {
-		return nil, parseError(fmt.Sprintf("syntax error, %s must with at least one value", token.ValueString()), token, stream, input)
+// exists($x) / has(#x) 解析器
+//
+// exists 的参数必须是 $ 参数，has 的参数必须是 # 参数
+func (analyzer *syntaxAnalyzer) existsParse(token *tokenizer.Token, stream *tokenizer.Stream, state *parseState) (syntax.Syntax, error) {
+	args, err := analyzer.argsParse(token, stream, state)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 1 {
+		return state.invalid(parseError(CodeInvalidArgument, fmt.Sprintf("syntax error, %s expect 1 argument", token.ValueString()), token, state.input)), nil
+	}
+	if hasInvalid(args) {
+		return &invalidSyntax{}, nil
 	}
 
-	return values, nil
+	placeholder := token.ValueString() == "exists"
+	p, ok := args[0].(param)
+	if ok {
+		_, isPlaceholder := p.Param()
+		ok = isPlaceholder == placeholder
+	}
+	if !ok {
+		example := "exists($userId)"
+		if !placeholder {
+			example = "has(#tenant)"
+		}
+		return state.invalid(parseError(CodeInvalidArgument, fmt.Sprintf("syntax error, %s expect a parameter. example: %s", token.ValueString(), example), token, state.input)), nil
+	}
+	_syntax, err := value.NewExistsSyntax(args[0])
+	if err != nil {
+		return state.invalid(parseError(CodeInvalidArgument, err.Error(), token, state.input)), nil
+	}
+	return _syntax, nil
 }
 
-func multiVarBuiltinFunctionParse(token *tokenizer.Token, stream *tokenizer.Stream, input string) (syntax.Syntax, error) {
+// any(list, x -> 条件) / all(list, x -> 条件) 解析器
+//
+// 条件中通过 x 访问列表元素，结束时 stream 停在 ")"
+func (analyzer *syntaxAnalyzer) quantifierParse(token *tokenizer.Token, stream *tokenizer.Stream, state *parseState) (syntax.Syntax, error) {
+	example := fmt.Sprintf("example: %s($tags, t -> t == 'public')", token.ValueString())
+	if !expectType(stream.GoNext().CurrentToken(), []tokenizer.TokenKey{TCurlyOpen}) {
+		return nil, parseError(CodeSyntax, fmt.Sprintf("syntax error, %s must with \"(\"", token.ValueString()), token, state.input)
+	}
+	stream.GoNext()
+	list, err := analyzer.parseWithScope(stream, 1, state)
+	if err != nil {
+		return nil, err
+	}
+	if !expectType(stream.CurrentToken(), []tokenizer.TokenKey{TComma}) {
+		return nil, parseError(CodeInvalidArgument, fmt.Sprintf("syntax error, %s expect 2 arguments. %s", token.ValueString(), example), token, state.input)
+	}
 
-	values, err := arrayParamsParse(token, stream, input)
+	variable := stream.GoNext().CurrentToken()
+	if !expectType(variable, []tokenizer.TokenKey{tokenizer.TokenKeyword}) || !expectType(stream.NextToken(), []tokenizer.TokenKey{TArrow}) {
+		return nil, parseError(CodeInvalidArgument, fmt.Sprintf("syntax error, %s expect a lambda as the second argument. %s", token.ValueString(), example), variable, state.input)
+	}
+	stream.GoNext()
+	stream.GoNext()
+
+	name := variable.ValueString()
+	state.locals[name]++
+	body, err := analyzer.parseWithScope(stream, 1, state)
+	state.locals[name]--
 	if err != nil {
 		return nil, err
 	}
+	if !expectType(stream.CurrentToken(), []tokenizer.TokenKey{TCurlyClose}) {
+		return nil, parseError(CodeUnbalancedParen, fmt.Sprintf("syntax error, %s must with \")\"", token.ValueString()), token, state.input)
+	}
+
+	if hasInvalid([]syntax.Syntax{list, body}) {
+		return &invalidSyntax{}, nil
+	}
+	_syntax, err := value.NewQuantifierSyntax(token.ValueString(), list, name, body)
+	if err != nil {
+		return state.invalid(parseError(CodeInvalidArgument, err.Error(), token, state.input)), nil
+	}
+	return _syntax, nil
+}
 
-	// after expect check
-	nextToken := stream.NextToken()
-	if nextToken.IsValid() && !expectStringValue(nextToken, []string{"and", "or", ")"}) {
-		return nil, parseError(fmt.Sprintf("%s(%s)\" %s only supports \"and\" and \"or\" constructions.\n", token.ValueString(), values, nextToken.ValueString()), token, stream, input)
+// lambda 变量解析器，可以带访问路径，如 o.customer.id
+func lambdaVarParse(token *tokenizer.Token, stream *tokenizer.Stream, input string) (syntax.Syntax, error) {
+	path, err := pathParse(token, stream, input)
+	if err != nil {
+		return nil, err
 	}
+	return value.NewLambdaVarSyntax(token.ValueString(), path...), nil
+}
 
-	tokenString := token.ValueString()
-	switch tokenString {
-	case "Roles":
-		return value.NewRolesSyntax(values), nil
-	case "Permissions":
-		return value.NewPermissionsSyntax(values), nil
-	case "Groups":
-		return value.NewGroupsSyntax(values), nil
+// AtLeast(n, Permissions(...)) 解析器
+//
+// n 必须是正整数常量，第二个参数必须是 Roles / Permissions / Groups 等多值内置函数
+func (analyzer *syntaxAnalyzer) atLeastParse(token *tokenizer.Token, stream *tokenizer.Stream, state *parseState) (syntax.Syntax, error) {
+	args, err := analyzer.argsParse(token, stream, state)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 2 {
+		return state.invalid(parseError(CodeInvalidArgument, fmt.Sprintf("syntax error, %s expect 2 arguments", token.ValueString()), token, state.input)), nil
+	}
+	if hasInvalid(args) {
+		return &invalidSyntax{}, nil
 	}
 
-	return nil, parseError("unknow builtin function", token, stream, input)
+	_syntax, err := value.NewAtLeastSyntax(args[0], args[1])
+	if err != nil {
+		return state.invalid(parseError(CodeInvalidArgument, err.Error(), token, state.input)), nil
+	}
+	return _syntax, nil
 }
 
-// Role Permission Group
-func singleVarBuiltinFunctionParse(token *tokenizer.Token, stream *tokenizer.Stream, input string) (syntax.Syntax, error) {
-	curlyOpen := stream.GoNext().CurrentToken()
-	// must with (
-	if !expectType(curlyOpen, []tokenizer.TokenKey{TCurlyOpen}) {
-		return nil, parseError(fmt.Sprintf("syntax error, %s must with \"(\"", token.ValueString()), token, stream, input)
+// Roles Permissions Groups AllRoles AllPermissions AllGroups
+//
+// 参数可以是任意字符串表达式，如 Groups($team, 'admins')
+func (analyzer *syntaxAnalyzer) multiVarBuiltinFunctionParse(token *tokenizer.Token, stream *tokenizer.Stream, state *parseState) (syntax.Syntax, error) {
+	args, err := analyzer.argsParse(token, stream, state)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return state.invalid(parseError(CodeInvalidArgument, fmt.Sprintf("syntax error, %s must with at least one value", token.ValueString()), token, state.input)), nil
 	}
 
-	vToken := stream.GoNext().CurrentToken()
-	val := vToken.ValueString()
-	val = strings.Trim(val, "'")
-	val = strings.Trim(val, "\"")
-	// must with StringConstant
-	if !expectType(vToken, []tokenizer.TokenKey{tokenizer.TokenString}) {
-		return nil, parseError(fmt.Sprintf("grammatical error, you need input string. example: %s(\"something\")\n", token.ValueString()), token, stream, input)
+	name := token.ValueString()
+	_syntax, err := value.NewBuiltinSyntax(name, args, true, analyzer.reservedChars(name), func(values []string) (syntax.Syntax, error) {
+		switch name {
+		case "Roles":
+			if analyzer.roleHierarchy != nil {
+				return value.NewHierarchyRolesSyntax(values, analyzer.roleHierarchy), nil
+			}
+			return value.NewRolesSyntax(values), nil
+		case "Permissions":
+			if analyzer.wildcardPermission {
+				return value.NewWildcardPermissionsSyntax(values)
+			}
+			return value.NewPermissionsSyntax(values), nil
+		case "Groups":
+			return value.NewGroupsSyntax(values), nil
+		case "AllRoles":
+			return value.NewAllRolesSyntax(values, analyzer.roleHierarchy), nil
+		case "AllPermissions":
+			return value.NewAllPermissionsSyntax(values, analyzer.wildcardPermission)
+		case "AllGroups":
+			return value.NewAllGroupsSyntax(values), nil
+		}
+		return nil, fmt.Errorf("unknown builtin function")
+	})
+	if err != nil {
+		return state.invalid(parseError(CodeInvalidArgument, err.Error(), token, state.input)), nil
 	}
+	return _syntax, nil
+}
 
-	curlyClose := stream.GoNext().CurrentToken()
-	// must with )
-	if !expectType(curlyClose, []tokenizer.TokenKey{TCurlyClose}) {
-		return nil, parseError(fmt.Sprintf("syntax error, %s must with \")\"\n", vToken.ValueString()), token, stream, input)
+// 内置函数动态参数不能包含的字符
+//
+// 开启通配符权限时，权限参数的运行时取值不能包含 : , * ，避免参数值改变权限的层级或匹配范围
+func (analyzer *syntaxAnalyzer) reservedChars(name string) string {
+	switch name {
+	case "Permission", "Permissions", "AllPermissions":
+		if analyzer.wildcardPermission {
+			return value.WildcardReserved
+		}
 	}
+	return ""
+}
 
-	// after expect check
-	nextToken := stream.NextToken()
-	if nextToken.IsValid() && !expectStringValue(nextToken, []string{"and", "or", ")"}) {
-		return nil, parseError(fmt.Sprintf("%s(%s)\" %s only supports \"and\" and \"or\" constructions.\n", token.ValueString(), vToken.ValueString(), nextToken.ValueString()), token, stream, input)
+// Role Permission Group
+//
+// 参数可以是任意字符串表达式，如 Group($teamId) / Permission('orders.' + $tenant + '.read')
+func (analyzer *syntaxAnalyzer) singleVarBuiltinFunctionParse(token *tokenizer.Token, stream *tokenizer.Stream, state *parseState) (syntax.Syntax, error) {
+	args, err := analyzer.argsParse(token, stream, state)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 1 {
+		return state.invalid(parseError(CodeInvalidArgument, fmt.Sprintf("syntax error, %s expect 1 argument. example: %s(\"something\")", token.ValueString(), token.ValueString()), token, state.input)), nil
 	}
 
-	tokenString := token.ValueString()
-	switch tokenString {
-	case "Role":
-		return value.NewRoleSyntax(val), nil
-	case "Permission":
-		return value.NewPermissionSyntax(val), nil
-	case "Group":
-		return value.NewGroupSyntax(val), nil
+	name := token.ValueString()
+	_syntax, err := value.NewBuiltinSyntax(name, args, false, analyzer.reservedChars(name), func(values []string) (syntax.Syntax, error) {
+		val := values[0]
+		switch name {
+		case "Role":
+			if analyzer.roleHierarchy != nil {
+				return value.NewHierarchyRoleSyntax(val, analyzer.roleHierarchy), nil
+			}
+			return value.NewRoleSyntax(val), nil
+		case "Permission":
+			if analyzer.wildcardPermission {
+				return value.NewWildcardPermissionSyntax(val)
+			}
+			return value.NewPermissionSyntax(val), nil
+		case "Group":
+			return value.NewGroupSyntax(val), nil
+		}
+		return nil, fmt.Errorf("unknown builtin function")
+	})
+	if err != nil {
+		return state.invalid(parseError(CodeInvalidArgument, err.Error(), token, state.input)), nil
 	}
+	return _syntax, nil
+}
 
-	return nil, parseError("unknow builtin function", token, stream, input)
+// 可以作为参数名的 token
+//
+// 参数名与关键字/函数名相同时(如 $len / #in) 仍然当作参数名
+var paramNameTokens = []tokenizer.TokenKey{
+	tokenizer.TokenKeyword, tokenizer.TokenInteger,
+	TPolicy, TLogic, TMembership, TBool, TNull, TBuiltinFunction, TPrincipal,
 }
 
 // 占位符变量解析器
+//
+// 支持 $name / $0 (通配符) 以及指定来源的 $path.name / $query.name / $wildcard.0
 func placeholderSyntaxParse(token *tokenizer.Token, stream *tokenizer.Stream, input string) (syntax.Syntax, error) {
 	strToken := stream.GoNext().CurrentToken()
-	if expectType(strToken, []tokenizer.TokenKey{tokenizer.TokenKeyword}) {
-		return value.NewParamSyntax(strToken.ValueString(), true), nil
+	if !expectType(strToken, paramNameTokens) {
+		return nil, parseError(CodeInvalidReference, "syntax error, invalid parameter", token, input)
 	}
-	return nil, parseError("错误变量表达式", token, stream, input)
+	name := strToken.ValueString()
+	if ctx.IsParamSource(name) && expectType(stream.NextToken(), []tokenizer.TokenKey{TDot}) {
+		// $source.name
+		stream.GoNext()
+		nameToken := stream.GoNext().CurrentToken()
+		if !expectType(nameToken, paramNameTokens) {
+			return nil, parseError(CodeInvalidReference, fmt.Sprintf("syntax error, expect parameter name. example: $%s.name", name), token, input)
+		}
+		name = name + "." + nameToken.ValueString()
+	}
+	path, err := pathParse(token, stream, input)
+	if err != nil {
+		return nil, err
+	}
+	return value.NewParamSyntax(name, true, path...), nil
+}
+
+// 当事人属性解析器
+//
+// principal.id / principal.name
+func principalSyntaxParse(token *tokenizer.Token, stream *tokenizer.Stream, input string) (syntax.Syntax, error) {
+	if !expectType(stream.NextToken(), []tokenizer.TokenKey{TDot}) {
+		return nil, parseError(CodeInvalidReference, "syntax error, principal must with attribute. example: principal.id", token, input)
+	}
+	stream.GoNext()
+	attrToken := stream.GoNext().CurrentToken()
+	if !expectType(attrToken, paramNameTokens) || expectType(attrToken, []tokenizer.TokenKey{tokenizer.TokenInteger}) {
+		return nil, parseError(CodeInvalidReference, "syntax error, principal must with attribute. example: principal.id", token, input)
+	}
+	path, err := pathParse(token, stream, input)
+	if err != nil {
+		return nil, err
+	}
+	return value.NewPrincipalSyntax(attrToken.ValueString(), path...), nil
 }
 
 // 自定义变量解析器
 func customParamSyntaxParse(token *tokenizer.Token, stream *tokenizer.Stream, input string) (syntax.Syntax, error) {
 	strToken := stream.GoNext().CurrentToken()
-	if expectType(strToken, []tokenizer.TokenKey{tokenizer.TokenKeyword}) {
-		return value.NewParamSyntax(strToken.ValueString(), false), nil
+	if expectType(strToken, paramNameTokens) && !expectType(strToken, []tokenizer.TokenKey{tokenizer.TokenInteger}) {
+		path, err := pathParse(token, stream, input)
+		if err != nil {
+			return nil, err
+		}
+		return value.NewParamSyntax(strToken.ValueString(), false, path...), nil
+	}
+	return nil, parseError(CodeInvalidReference, "syntax error, invalid parameter", token, input)
+}
+
+// 访问路径解析器
+//
+// .name / [0] / ['name'] , 可以连续使用，如 #order.items[0].sku
+func pathParse(token *tokenizer.Token, stream *tokenizer.Stream, input string) ([]any, error) {
+	path := []any{}
+	for {
+		next := stream.NextToken()
+		if expectType(next, []tokenizer.TokenKey{TDot}) {
+			// .name
+			stream.GoNext()
+			nameToken := stream.GoNext().CurrentToken()
+			if !expectType(nameToken, paramNameTokens) {
+				return nil, parseError(CodeInvalidReference, "syntax error, expect field name after \".\". example: #order.customer.id", token, input)
+			}
+			path = append(path, nameToken.ValueString())
+		} else if expectType(next, []tokenizer.TokenKey{TBracketOpen}) {
+			// [0] / ['name']
+			stream.GoNext()
+			indexToken := stream.GoNext().CurrentToken()
+			switch {
+			case expectType(indexToken, []tokenizer.TokenKey{tokenizer.TokenInteger}):
+				path = append(path, int(indexToken.ValueInt64()))
+			case expectType(indexToken, []tokenizer.TokenKey{tokenizer.TokenString}):
+				path = append(path, strings.Trim(strings.Trim(indexToken.ValueString(), "'"), "\""))
+			default:
+				return nil, parseError(CodeInvalidReference, "syntax error, expect index or string in \"[]\". example: #items[0]", token, input)
+			}
+			if !expectType(stream.GoNext().CurrentToken(), []tokenizer.TokenKey{TBracketClose}) {
+				return nil, parseError(CodeInvalidReference, "syntax error, \"[\" must with \"]\"", token, input)
+			}
+		} else {
+			return path, nil
+		}
 	}
-	return nil, parseError("错误变量表达式", token, stream, input)
 }
 
 // 字符串常量解析器
@@ -366,34 +881,84 @@ func constantSyntaxParse(token *tokenizer.Token, stream *tokenizer.Stream, input
 		val = strings.Trim(val, "\"")
 		return value.NewConstantSyntax(val), nil
 	case tokenizer.TokenInteger:
+		if _, err := strconv.ParseInt(token.ValueString(), 0, 64); err != nil {
+			return nil, parseError(CodeInvalidLiteral, fmt.Sprintf("integer %s out of int64 range", token.ValueString()), token, input)
+		}
 		return value.NewConstantSyntax(token.ValueInt64()), nil
 	case tokenizer.TokenFloat:
 		return value.NewConstantSyntax(token.ValueFloat64()), nil
+	case TBool:
+		return value.NewConstantSyntax(token.ValueString() == "true"), nil
+	case TNull:
+		return value.NewConstantSyntax(nil), nil
 	}
 
-	return nil, parseError("错误常量表达式,目前仅支持 字符串 / 数字 / 布尔 常量", token, stream, input)
+	return nil, parseError(CodeInvalidLiteral, "syntax error, only string / number / bool / null constants are supported", token, input)
+}
+
+// 列表常量解析器
+//
+// ['a', 'b', 3] , 元素只能是常量，解析时构建成集合
+func listSyntaxParse(token *tokenizer.Token, stream *tokenizer.Stream, input string) (syntax.Syntax, error) {
+	items := []any{}
+	nextToken := stream.GoNext().CurrentToken()
+	for !expectType(nextToken, []tokenizer.TokenKey{TBracketClose}) || len(items) > 0 {
+		if !expectType(nextToken, []tokenizer.TokenKey{tokenizer.TokenString, tokenizer.TokenInteger, tokenizer.TokenFloat, TBool, TNull}) {
+			return nil, parseError(CodeInvalidLiteral, "syntax error, list only supports string / number / bool / null constants", nextToken, input)
+		}
+		item, err := constantSyntaxParse(nextToken, stream, input)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item.Evaluate(nil).Value)
+
+		nextToken = stream.GoNext().CurrentToken()
+		if expectType(nextToken, []tokenizer.TokenKey{TBracketClose}) {
+			break
+		}
+		if !expectType(nextToken, []tokenizer.TokenKey{TComma}) {
+			return nil, parseError(CodeInvalidLiteral, "syntax error, list must with \"]\"", token, input)
+		}
+		nextToken = stream.GoNext().CurrentToken()
+	}
+	return value.NewListSyntax(items), nil
 }
 
 // 值语句解析
-func valueSyntaxParse(token *tokenizer.Token, stream *tokenizer.Stream, input string) (syntax.Syntax, error) {
-	if expectType(token, []tokenizer.TokenKey{tokenizer.TokenString, tokenizer.TokenInteger, tokenizer.TokenFloat}) {
-		// Constant[String|Number] / Param
-		return constantSyntaxParse(token, stream, input)
-	} else if expectType(token, []tokenizer.TokenKey{TPlaceholder}) {
-		return placeholderSyntaxParse(token, stream, input)
-	} else if expectType(token, []tokenizer.TokenKey{TCustomParam}) {
-		return customParamSyntaxParse(token, stream, input)
+func (analyzer *syntaxAnalyzer) valueSyntaxParse(token *tokenizer.Token, stream *tokenizer.Stream, state *parseState) (syntax.Syntax, error) {
+	if expectType(token, []tokenizer.TokenKey{tokenizer.TokenString, tokenizer.TokenInteger, tokenizer.TokenFloat, TBool, TNull}) {
+		// Constant[String|Number|Bool|Null]
+		return constantSyntaxParse(token, stream, state.input)
+	} else if expectType(token, []tokenizer.TokenKey{TPlaceholder, TCustomParam}) {
+		parse := placeholderSyntaxParse
+		if token.Key() == TCustomParam {
+			parse = customParamSyntaxParse
+		}
+		_syntax, err := parse(token, stream, state.input)
+		if err != nil {
+			return nil, err
+		}
+		if r, ok := _syntax.(value.Required); ok && state.missingParamError {
+			r.SetRequired()
+		}
+		return _syntax, nil
+	} else if expectType(token, []tokenizer.TokenKey{TPrincipal}) {
+		return principalSyntaxParse(token, stream, state.input)
 	} else if expectType(token, []tokenizer.TokenKey{TBuiltinFunction}) {
 		// Role/Permission/Group
-		return builtinFunctionParse(token, stream, input)
+		return analyzer.builtinFunctionParse(token, stream, state)
+	} else if expectType(token, []tokenizer.TokenKey{TBracketOpen}) {
+		return listSyntaxParse(token, stream, state.input)
+	} else if state.isLocal(token) {
+		return lambdaVarParse(token, stream, state.input)
 	}
 
-	return nil, parseError("unknow value syntax", token, stream, input)
+	return nil, parseError(CodeSyntax, "syntax error, unknown value", token, state.input)
 }
 
 // 操作语句解析
-func operSyntaxParse(token *tokenizer.Token, stream *tokenizer.Stream, input string) (syntax.Syntax, error) {
-	switch token.ValueString() {
+func operSyntaxParse(def *syntaxDef, stream *tokenizer.Stream, input string) (syntax.Syntax, error) {
+	switch def.Operator {
 	case "+":
 		return oper.NewAddSyntax(nil, nil), nil
 	case "-":
@@ -422,16 +987,22 @@ func operSyntaxParse(token *tokenizer.Token, stream *tokenizer.Stream, input str
 		return oper.NewOrSyntax(nil, nil), nil
 	case "!":
 		return oper.NewNegateSyntax(nil), nil
+	case "in":
+		return oper.NewInSyntax(nil, nil), nil
+	case "not in":
+		return oper.NewNotInSyntax(nil, nil), nil
+	case "??":
+		return oper.NewCoalesceSyntax(nil, nil), nil
 	}
 
-	return nil, parseError("unknow oper syntax", token, stream, input)
+	return nil, parseError(CodeSyntax, "syntax error, unknown operator", def.Token, input)
 }
 
 // expectValueToken
 // 检查当前token值 是否属于 "值Token" (ValueToken)
 func expectValueToken(token *tokenizer.Token) bool {
 	switch token.Key() {
-	case TBuiltinFunction, tokenizer.TokenString, TPlaceholder, TCustomParam, tokenizer.TokenFloat, tokenizer.TokenInteger:
+	case TBuiltinFunction, tokenizer.TokenString, TPlaceholder, TCustomParam, tokenizer.TokenFloat, tokenizer.TokenInteger, TBool, TNull, TBracketOpen, TPrincipal:
 		return true
 	}
 
@@ -461,27 +1032,3 @@ func (l *syntaxAnalyzer) DebugTokens(input string) {
 	}
 
 }
-
-func parseError(msg string, token *tokenizer.Token, stream *tokenizer.Stream, input string) error {
-	limitLen := len(input)
-	if limitLen > token.Offset()+25 {
-		limitLen = token.Offset() + 25
-	}
-	before := input[:token.Offset()]
-	after := input[token.Offset():limitLen]
-	errorContext := input
-	tipsLine := tipsLine(len(before), len(after))
-	return fmt.Errorf("[%d:%d] \"%s\": %s\n%s\n%s", token.Line(), token.Offset(), token.ValueString(), msg, errorContext, tipsLine)
-}
-
-func tipsLine(offset int, after int) string {
-	line := ""
-	for i := 0; i < offset; i++ {
-		line += "-"
-	}
-	line += "^"
-	for i := 0; i < after; i++ {
-		line += "-"
-	}
-	return line
-}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/einsitang/go-security/internal/expr/ctx"
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
 	"github.com/einsitang/go-security/internal/expr/tokenizer"
 )
 
@@ -122,3 +123,91 @@ func TestAnalyzer(t *testing.T) {
 	t.Logf("cheked ( %s ): %v \n", st.Policy, st.Syntax.Evaluate(context).Value)
 
 }
+
+// 以 S 表达式输出语法树，叶子节点输出原始文本
+func formatTree(st *SyntaxTree, node syntax.Syntax) string {
+	info := st.nodes[node]
+	switch node.Kind() {
+	case 1:
+		return "(" + info.operator + " " + formatTree(st, node.Left()) + ")"
+	case 2:
+		return "(" + info.operator + " " + formatTree(st, node.Left()) + " " + formatTree(st, node.Right()) + ")"
+	}
+	return st.input[info.span.Start:info.span.End]
+}
+
+func TestParse_Precedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"$a - $b - $c", "(- (- $a $b) $c)"},
+		{"$a / $b * $c % $d", "(% (* (/ $a $b) $c) $d)"},
+		{"$a + $b * $c", "(+ $a (* $b $c))"},
+		{"$a * $b + $c", "(+ (* $a $b) $c)"},
+		{"($a + $b) * $c", "(* (+ $a $b) $c)"},
+		{"$a or $b and $c", "(or $a (and $b $c))"},
+		{"$a and $b or $c and $d", "(or (and $a $b) (and $c $d))"},
+		{"$a or $b or $c", "(or (or $a $b) $c)"},
+		{"($a or $b) and $c", "(and (or $a $b) $c)"},
+		{"!$a == 1", "(! (== $a 1))"},
+		{"!$a and $b", "(and (! $a) $b)"},
+		{"!Role('a') or Role('b')", "(or (! Role('a')) Role('b'))"},
+		{"!!$a", "(! (! $a))"},
+		{"$a == !$b and $c", "(and (== $a (! $b)) $c)"},
+		{"!($a or $b)", "(! (or $a $b))"},
+		{"Role('a') == true", "(== Role('a') true)"},
+		{"Role('a') != false and Group('b')", "(and (!= Role('a') false) Group('b'))"},
+		{"$a < 3 == true", "(== (< $a 3) true)"},
+		{"$a + 1 > $b * 2", "(> (+ $a 1) (* $b 2))"},
+		{"$a in [1, 2] and $b not in ['x']", "(and (in $a [1, 2]) (not in $b ['x']))"},
+		{"$a + 1 in [2, 3]", "(in (+ $a 1) [2, 3])"},
+		{"!$a in [true]", "(! (in $a [true]))"},
+		{"'orders.' + $t + '.read' == $p", "(== (+ (+ 'orders.' $t) '.read') $p)"},
+		{"startsWith($a + 'x', 'b') or $c", "(or startsWith($a + 'x', 'b') $c)"},
+		{"$a ?? 0 > 1", "(> (?? $a 0) 1)"},
+		{"$a ?? $b + 1 == $c", "(== (?? $a (+ $b 1)) $c)"},
+		{"$a ?? $b ?? 'x'", "(?? (?? $a $b) 'x')"},
+		{"any($a, t -> t > 1 and t < 3) or $b", "(or any($a, t -> t > 1 and t < 3) $b)"},
+		{"now() - date($a) < duration('1h') * 24", "(< (- now() date($a)) (* duration('1h') 24))"},
+	}
+
+	analyzer := NewAnalyzer()
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			st, err := analyzer.Parse("allow: " + tt.input)
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			if tree := formatTree(st, st.Syntax); tree != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, tree)
+			}
+		})
+	}
+}
+
+func TestParse_SyntaxErrors(t *testing.T) {
+	inputs := []string{
+		"Role('a') Role('b')",
+		"$a $b",
+		"$a +",
+		"and $a",
+		"($a == 1",
+		"$a == 1)",
+		"$a not $b",
+		"!",
+		"$a == == 1",
+		"$a !",
+		"()",
+		"$a, $b",
+	}
+
+	analyzer := NewAnalyzer()
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			if _, err := analyzer.Parse("allow: " + input); err == nil {
+				t.Errorf("Expected syntax error for %s", input)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package function
+
+import (
+	"fmt"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+)
+
+// 函数实现
+//
+// args 为参数求值结果，参数个数与类型已在解析时检查
+type Impl func(c *ctx.Context, args []any) (any, error)
+
+// 函数定义
+type Func struct {
+	// 函数名
+	Name string
+
+	// 每个参数接受的类型
+	Args []int
+
+	// 返回值类型
+	Return int
+
+	// 函数实现
+	Impl Impl
+
+	// 可选，解析时调用，可以对常量参数做预处理(如编译正则表达式)并返回新的实现
+	//
+	// 返回错误时解析失败
+	Prepare func(args []syntax.Syntax) (Impl, error)
+
+	// 可选，按解析器的十进制 / 严格类型模式生成实现(如 contains 与 in 的比较规则一致)，设置后代替 Impl
+	WithMode func(decimal, strict bool) Impl
+}
+
+// 函数调用语句
+type funcSyntax struct {
+	def      *Func
+	impl     Impl
+	args     []syntax.Syntax
+	priority int
+	kind     int
+}
+
+func (s *funcSyntax) Priority() int {
+	return s.priority
+}
+
+func (s *funcSyntax) Kind() int {
+	return s.kind
+}
+
+func (s *funcSyntax) InputType() int {
+	return syntax.Type_String | syntax.Type_Number | syntax.Type_Bool | syntax.Type_Null
+}
+
+func (s *funcSyntax) ReturnType() int {
+	return s.def.Return
+}
+
+func (s *funcSyntax) Left() syntax.Syntax {
+	panic("Syntax not support left value")
+}
+
+func (s *funcSyntax) Right() syntax.Syntax {
+	panic("Syntax not support right value")
+}
+
+func (s *funcSyntax) ChangeLeft(left syntax.Syntax) {
+	panic("Syntax not support left value")
+}
+
+func (s *funcSyntax) ChangeRight(right syntax.Syntax) {
+	panic("Syntax not support right value")
+}
+
+// 函数参数
+func (s *funcSyntax) Operands() []syntax.Syntax {
+	return s.args
+}
+
+// 运行求值
+func (s *funcSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
+	values := make([]any, len(s.args))
+	for i, arg := range s.args {
+		v := arg.Evaluate(c)
+		if v.IsError {
+			return syntax.SyntaxValue{
+				IsError: true,
+				Error:   v.Error,
+			}
+		}
+		values[i] = v.Value
+	}
+
+	result, err := s.impl(c, values)
+	if err != nil {
+		return syntax.SyntaxValue{
+			IsError: true,
+			Error:   fmt.Errorf("%s: %w", s.def.Name, err),
+		}
+	}
+
+	// 函数可以由使用者注册，返回值类型需要在运行时检查
+	t := syntax.InferType(result)
+	if result == nil {
+		t = syntax.Type_Null
+	}
+	if t&s.def.Return == 0 {
+		return syntax.SyntaxValue{
+			IsError: true,
+			Error:   fmt.Errorf("%s: unexpected return value \"%v\"", s.def.Name, result),
+		}
+	}
+	return syntax.SyntaxValue{
+		Type:  t,
+		Value: result,
+	}
+}
+
+// 创建函数调用语句，检查参数个数和类型
+//
+// decimal / strict 为解析器的十进制 / 严格类型模式
+func NewFuncSyntax(def *Func, args []syntax.Syntax, decimal, strict bool) (syntax.Syntax, error) {
+	if len(args) != len(def.Args) {
+		return nil, fmt.Errorf("%s expect %d arguments, but got %d", def.Name, len(def.Args), len(args))
+	}
+	for i, arg := range args {
+		if arg.ReturnType()&def.Args[i] == 0 {
+			return nil, fmt.Errorf("mismatched types, %s argument %d", def.Name, i+1)
+		}
+	}
+
+	impl := def.Impl
+	if def.WithMode != nil {
+		impl = def.WithMode(decimal, strict)
+	}
+	if def.Prepare != nil {
+		var err error
+		if impl, err = def.Prepare(args); err != nil {
+			return nil, fmt.Errorf("%s: %w", def.Name, err)
+		}
+	}
+	return &funcSyntax{
+		def:      def,
+		impl:     impl,
+		args:     args,
+		priority: 100,
+		kind:     0,
+	}, nil
+}
@@ -0,0 +1,32 @@
+package function
+
+import (
+	"errors"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+)
+
+// 内置当事人函数
+//
+//	Owner(id) : 当事人的 Id() 是否等于 id (id 不能为空), 如 Owner($userId)
+func PrincipalFuncs() []*Func {
+	return []*Func{
+		{
+			Name:   "Owner",
+			Args:   []int{stringArg},
+			Return: syntax.Type_Bool,
+			Impl: func(c *ctx.Context, args []any) (any, error) {
+				if c.Principal == nil {
+					return nil, errors.New("principal is nil")
+				}
+				id, err := expectString(args[0])
+				if err != nil {
+					return nil, err
+				}
+				// 空 id 不属于任何人
+				return id != "" && c.Principal.Id() == id, nil
+			},
+		},
+	}
+}
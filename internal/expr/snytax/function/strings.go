@@ -0,0 +1,143 @@
+package function
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cast"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+	"github.com/einsitang/go-security/internal/expr/snytax/oper"
+)
+
+// 字符串参数: 接受字符串以及数字(如 $id)
+const stringArg = syntax.Type_String | syntax.Type_Number
+
+// 内置字符串函数
+//
+//	startsWith(s, prefix) / endsWith(s, suffix) / contains(s, sub) / matches(s, pattern)
+//	lower(s) / upper(s) / len(s)
+func StringFuncs() []*Func {
+	return []*Func{
+		{
+			Name:   "startsWith",
+			Args:   []int{stringArg, stringArg},
+			Return: syntax.Type_Bool,
+			Impl:   stringPredicate(strings.HasPrefix),
+		},
+		{
+			Name:   "endsWith",
+			Args:   []int{stringArg, stringArg},
+			Return: syntax.Type_Bool,
+			Impl:   stringPredicate(strings.HasSuffix),
+		},
+		{
+			Name:     "contains",
+			Args:     []int{stringArg, stringArg},
+			Return:   syntax.Type_Bool,
+			WithMode: containsImpl,
+		},
+		{
+			Name:    "matches",
+			Args:    []int{stringArg, syntax.Type_String},
+			Return:  syntax.Type_Bool,
+			Prepare: prepareMatches,
+		},
+		{
+			Name:   "lower",
+			Args:   []int{stringArg},
+			Return: syntax.Type_String,
+			Impl:   stringMapping(strings.ToLower),
+		},
+		{
+			Name:   "upper",
+			Args:   []int{stringArg},
+			Return: syntax.Type_String,
+			Impl:   stringMapping(strings.ToUpper),
+		},
+		{
+			Name:   "len",
+			Args:   []int{stringArg},
+			Return: syntax.Type_Number,
+			Impl: func(c *ctx.Context, args []any) (any, error) {
+				s, err := expectString(args[0])
+				if err != nil {
+					return nil, err
+				}
+				// 按字符计算长度
+				return utf8.RuneCountInString(s), nil
+			},
+		},
+	}
+}
+
+func stringPredicate(fn func(s, sub string) bool) Impl {
+	return func(c *ctx.Context, args []any) (any, error) {
+		s, err := expectString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		sub, err := expectString(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return fn(s, sub), nil
+	}
+}
+
+// contains(s, sub) 是否包含子串；s 为列表(如重复的查询参数)时是否包含元素 sub ，规则与 in 相同(包括十进制 / 严格类型模式)
+func containsImpl(decimal, strict bool) Impl {
+	return func(c *ctx.Context, args []any) (any, error) {
+		if syntax.InferType(args[0]) == syntax.Type_List {
+			return oper.Contains(args[0], args[1], decimal, strict)
+		}
+		return stringPredicate(strings.Contains)(c, args)
+	}
+}
+
+func stringMapping(fn func(s string) string) Impl {
+	return func(c *ctx.Context, args []any) (any, error) {
+		s, err := expectString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return fn(s), nil
+	}
+}
+
+// matches 的正则表达式必须是字符串常量，在解析时编译
+func prepareMatches(args []syntax.Syntax) (Impl, error) {
+	constant, ok := args[1].(syntax.Constant)
+	if !ok {
+		return nil, errors.New("pattern must be a string constant")
+	}
+	re, err := regexp.Compile(cast.ToString(constant.Constant()))
+	if err != nil {
+		return nil, err
+	}
+	return func(c *ctx.Context, args []any) (any, error) {
+		s, err := expectString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(s), nil
+	}, nil
+}
+
+// 参数值由调用方传入，类型只能在运行时检查
+func expectString(v any) (string, error) {
+	switch v.(type) {
+	case nil:
+		return "", errors.New("expect string, but got null")
+	case bool:
+		return "", fmt.Errorf("expect string, but got \"%v\"", v)
+	}
+	if syntax.InferType(v) == syntax.Type_List {
+		return "", fmt.Errorf("expect string, but got list \"%v\", use any() / all() for multi-valued parameters", v)
+	}
+	return cast.ToStringE(v)
+}
@@ -0,0 +1,197 @@
+package function
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+)
+
+// date() 支持的格式，不带时区时按 UTC 处理
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// 内置时间函数
+//
+//	now() / date(s) / duration(s)
+//	hour(t, zone) / weekday(t, zone)
+func TimeFuncs() []*Func {
+	return []*Func{
+		{
+			Name:   "now",
+			Args:   []int{},
+			Return: syntax.Type_Time,
+			Impl: func(c *ctx.Context, args []any) (any, error) {
+				return c.Now(), nil
+			},
+		},
+		{
+			Name:    "date",
+			Args:    []int{stringArg | syntax.Type_Time},
+			Return:  syntax.Type_Time,
+			Impl:    convertImpl(toTime),
+			Prepare: prepareConstant(toTime),
+		},
+		{
+			Name:    "duration",
+			Args:    []int{stringArg | syntax.Type_Duration},
+			Return:  syntax.Type_Duration,
+			Impl:    convertImpl(toDuration),
+			Prepare: prepareConstant(toDuration),
+		},
+		{
+			Name:    "hour",
+			Args:    []int{syntax.Type_Time, syntax.Type_String},
+			Return:  syntax.Type_Number,
+			Prepare: prepareInZone(func(t time.Time) any { return t.Hour() }),
+		},
+		{
+			Name:    "weekday",
+			Args:    []int{syntax.Type_Time, syntax.Type_String},
+			Return:  syntax.Type_Number,
+			Prepare: prepareInZone(func(t time.Time) any { return int(t.Weekday()) }),
+		},
+	}
+}
+
+func convertImpl[T any](convert func(v any) (T, error)) Impl {
+	return func(c *ctx.Context, args []any) (any, error) {
+		return convert(args[0])
+	}
+}
+
+// 参数为常量时在解析时转换，格式有误时 NewGuard / AddEndpoint 直接返回错误
+func prepareConstant[T any](convert func(v any) (T, error)) func(args []syntax.Syntax) (Impl, error) {
+	return func(args []syntax.Syntax) (Impl, error) {
+		constant, ok := args[0].(syntax.Constant)
+		if !ok {
+			return convertImpl(convert), nil
+		}
+		v, err := convert(constant.Constant())
+		if err != nil {
+			return nil, err
+		}
+		return func(c *ctx.Context, args []any) (any, error) {
+			return v, nil
+		}, nil
+	}
+}
+
+// 按时区取时间的某个部分，时区为常量时在解析时加载
+func prepareInZone(part func(t time.Time) any) func(args []syntax.Syntax) (Impl, error) {
+	return func(args []syntax.Syntax) (Impl, error) {
+		var zone *time.Location
+		if constant, ok := args[1].(syntax.Constant); ok {
+			var err error
+			if zone, err = loadZone(constant.Constant()); err != nil {
+				return nil, err
+			}
+		}
+		return func(c *ctx.Context, args []any) (any, error) {
+			t, err := toTime(args[0])
+			if err != nil {
+				return nil, err
+			}
+			loc := zone
+			if loc == nil {
+				if loc, err = loadZone(args[1]); err != nil {
+					return nil, err
+				}
+			}
+			return part(t.In(loc)), nil
+		}, nil
+	}
+}
+
+// 时区名称，如 Asia/Shanghai / UTC
+func loadZone(v any) (*time.Location, error) {
+	name, ok := v.(string)
+	if !ok || name == "" || name == "Local" {
+		// 不使用服务器本地时区，避免同一条规则在不同机器上结果不同
+		return nil, fmt.Errorf("invalid time zone \"%v\"", v)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone \"%s\"", name)
+	}
+	return loc, nil
+}
+
+// 转换成时间
+//
+// 支持 time.Time 、日期字符串(见 dateLayouts) 以及 Unix 时间戳(秒)
+func toTime(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case nil, bool, time.Duration:
+	case string:
+		s := strings.TrimSpace(v)
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return time.Time{}, fmt.Errorf("invalid date \"%s\"", v)
+		}
+		return unixTime(s)
+	default:
+		return unixTime(v)
+	}
+	return time.Time{}, fmt.Errorf("expect time, but got \"%v\"", v)
+}
+
+func unixTime(v any) (time.Time, error) {
+	f, err := cast.ToFloat64E(v)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return time.Time{}, fmt.Errorf("expect time, but got \"%v\"", v)
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+}
+
+// 转换成时长
+//
+// 支持 time.Duration 、时长字符串(如 24h / 1h30m / 500ms) 以及秒数
+func toDuration(v any) (time.Duration, error) {
+	switch v := v.(type) {
+	case time.Duration:
+		return v, nil
+	case nil, bool, time.Time:
+	case string:
+		s := strings.TrimSpace(v)
+		if d, err := time.ParseDuration(s); err == nil {
+			return d, nil
+		}
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return 0, fmt.Errorf("invalid duration \"%s\"", v)
+		}
+		return seconds(s)
+	default:
+		return seconds(v)
+	}
+	return 0, fmt.Errorf("expect duration, but got \"%v\"", v)
+}
+
+func seconds(v any) (time.Duration, error) {
+	f, err := cast.ToFloat64E(v)
+	if err != nil {
+		return 0, fmt.Errorf("expect duration, but got \"%v\"", v)
+	}
+	d := f * float64(time.Second)
+	if math.IsNaN(d) || d >= math.MaxInt64 || d < math.MinInt64 {
+		return 0, errors.New("duration out of range")
+	}
+	return time.Duration(d), nil
+}
@@ -0,0 +1,50 @@
+package syntax
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// 列表常量 ['a', 'b', 3]
+//
+// 解析时一次性构建成员索引，in / not in / contains 不需要逐个比较
+type List struct {
+	items []any
+	index Index
+}
+
+// 列表的成员索引，比较规则与 == 一致，由 oper 构建
+type Index interface {
+	Contains(v any, decimal, strict bool) (bool, error)
+}
+
+func NewList(items []any, index Index) *List {
+	return &List{items: items, index: index}
+}
+
+// 列表元素
+func (l *List) Items() []any {
+	return l.items
+}
+
+// 成员索引，可能为 nil
+func (l *List) Index() Index {
+	return l.index
+}
+
+func (l *List) String() string {
+	items := make([]string, len(l.items))
+	for i, item := range l.items {
+		switch v := item.(type) {
+		case nil:
+			items[i] = "null"
+		case string:
+			items[i] = strconv.Quote(v)
+		default:
+			items[i] = cast.ToString(v)
+		}
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
@@ -10,6 +10,20 @@ type builtiOperSyntax struct {
 	kind        int
 	left, right syntax.Syntax
 	evalute     func(a, b syntax.SyntaxValue) syntax.SyntaxValue
+	// 十进制模式，只对数值运算和比较有效
+	decimal bool
+	// 严格类型模式，只对比较有效
+	strict bool
+}
+
+// 开启十进制模式
+func (s *builtiOperSyntax) SetDecimal() {
+	s.decimal = true
+}
+
+// 开启严格类型模式
+func (s *builtiOperSyntax) SetStrictTypes() {
+	s.strict = true
 }
 
 // 语句优先级
@@ -24,7 +38,7 @@ func (s *builtiOperSyntax) Kind() int {
 
 // 入参类型要求
 func (s *builtiOperSyntax) InputType() int {
-	return syntax.Type_Bool | syntax.Type_Number | syntax.Type_String
+	return syntax.Type_Bool | syntax.Type_Number | syntax.Type_String | syntax.Type_Time | syntax.Type_Duration
 }
 
 // 支持的出参类型,具体结果得执行 Evaluate 运行后得出
@@ -0,0 +1,62 @@
+package oper
+
+import (
+	"github.com/einsitang/go-security/internal/expr/ctx"
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+)
+
+// ?? null 合并
+//
+// 左值不存在或为 null 时取右值: $region ?? 'cn'
+type coalesceSyntax struct {
+	builtiOperSyntax
+}
+
+func (s *coalesceSyntax) InputType() int {
+	return syntax.Type_Bool | syntax.Type_Number | syntax.Type_String | syntax.Type_Null | syntax.Type_Time | syntax.Type_Duration
+}
+
+// 左值不为 null 时的类型 或 右值类型
+func (s *coalesceSyntax) ReturnType() int {
+	if s.left == nil || s.right == nil {
+		return s.InputType()
+	}
+	return s.left.ReturnType()&^syntax.Type_Null | s.right.ReturnType()
+}
+
+// 短路求值: 左值存在且不为 null 时不再计算右值
+//
+// 左值为参数时不存在(包括访问路径无法解析)也不会返回错误
+func (s *coalesceSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
+	if optional, ok := s.left.(syntax.Optional); ok {
+		if v, found := optional.Lookup(c); found && v != nil {
+			return syntax.SyntaxValue{
+				Type:  syntax.InferType(v),
+				Value: v,
+			}
+		}
+		return s.right.Evaluate(c)
+	}
+
+	leftR := s.left.Evaluate(c)
+	if leftR.IsError || leftR.Value != nil {
+		return leftR
+	}
+	return s.right.Evaluate(c)
+}
+
+// 左值是否已能决定结果
+func (s *coalesceSyntax) ShortCircuit(left any) bool {
+	return left != nil
+}
+
+func NewCoalesceSyntax(left, right syntax.Syntax) syntax.Syntax {
+	return &coalesceSyntax{
+		builtiOperSyntax{
+			kind:     2,
+			priority: syntax.PrecedenceCoalesce,
+			left:     left,
+			right:    right,
+		},
+	}
+}
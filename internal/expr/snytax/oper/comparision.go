@@ -12,25 +12,24 @@ type eqSyntax struct {
 	builtiOperSyntax
 }
 
+// == 支持与 null 比较
+func (s *eqSyntax) InputType() int {
+	return syntax.Type_Bool | syntax.Type_Number | syntax.Type_String | syntax.Type_Null | syntax.Type_Time | syntax.Type_Duration
+}
+
 func NewEqSyntax(left, right syntax.Syntax) syntax.Syntax {
-	return &eqSyntax{
+	s := &eqSyntax{
 		builtiOperSyntax{
-			priority: 55,
+			priority: syntax.PrecedenceEquality,
 			kind:     2,
 			left:     left,
 			right:    right,
-			evalute: func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
-				// 判定两者类型，比如字符串 '2' != 2 , 需要考虑隐性转型？
-				// not eq 也存在相同问题
-				lv := cast.ToString(leftR.Value)
-				rv := cast.ToString(rightR.Value)
-				return syntax.SyntaxValue{
-					Type:  syntax.Type_Bool,
-					Value: lv == rv,
-				}
-			},
 		},
 	}
+	s.evalute = func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
+		return equalsEvaluate(leftR, rightR, &s.builtiOperSyntax, false)
+	}
+	return s
 }
 
 // !=
@@ -39,23 +38,121 @@ type notEqSyntax struct {
 	builtiOperSyntax
 }
 
+// != 支持与 null 比较
+func (s *notEqSyntax) InputType() int {
+	return syntax.Type_Bool | syntax.Type_Number | syntax.Type_String | syntax.Type_Null | syntax.Type_Time | syntax.Type_Duration
+}
+
 func NewNotEqSyntax(left, right syntax.Syntax) syntax.Syntax {
-	return &notEqSyntax{
+	s := &notEqSyntax{
 		builtiOperSyntax{
-			priority: 55,
+			priority: syntax.PrecedenceEquality,
 			kind:     2,
 			left:     left,
 			right:    right,
-			evalute: func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
-				lv := cast.ToString(leftR.Value)
-				rv := cast.ToString(rightR.Value)
-				return syntax.SyntaxValue{
-					Type:  syntax.Type_Bool,
-					Value: lv != rv,
-				}
-			},
 		},
 	}
+	s.evalute = func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
+		return equalsEvaluate(leftR, rightR, &s.builtiOperSyntax, true)
+	}
+	return s
+}
+
+func equalsEvaluate(lr, rr syntax.SyntaxValue, s *builtiOperSyntax, negate bool) syntax.SyntaxValue {
+	eq, err := equals(lr.Value, rr.Value, s.decimal, s.strict)
+	if err != nil {
+		return syntax.SyntaxValue{
+			Error:   err,
+			IsError: true,
+		}
+	}
+	return syntax.SyntaxValue{
+		Type:  syntax.Type_Bool,
+		Value: eq != negate,
+	}
+}
+
+// == / != 的比较规则
+//
+// - 任意一方为 null 时，仅当两者都为 null 才相等
+//
+// - 数字之间按数值比较，如 1 == 1.0 ；字符串之间按原值比较，'1.50' != '1.5'
+//
+// - 数字与字符串: 字符串能解析成数字时按数值比较，如 1.5 == '1.50' ，否则不相等
+//
+// - bool 与字符串: 字符串需能转换为 bool (如 'true') 且值相同；bool 与数字永远不相等
+//
+// - 时间之间按时刻比较(忽略时区)，时长之间按长度比较，与其他类型永远不相等
+//
+// - 列表(多值参数) 不能比较，返回错误
+//
+// 严格模式下除 null 外两侧类型不同时返回 ErrTypeMismatch
+func equals(lv, rv any, decimal, strict bool) (bool, error) {
+	if lv == nil || rv == nil {
+		return lv == nil && rv == nil, nil
+	}
+	lt, rt := syntax.InferType(lv), syntax.InferType(rv)
+	if lt == syntax.Type_List || rt == syntax.Type_List {
+		// 多值参数(如 ?tag=a&tag=b) 不能直接比较，避免只比较其中一个值
+		return false, listOperandError(lv, rv)
+	}
+	if lt != rt {
+		if strict {
+			return false, fmt.Errorf("%w: cannot compare %s \"%v\" with %s \"%v\"", ErrTypeMismatch, typeName(lt), lv, typeName(rt), rv)
+		}
+		if lb, ok := lv.(bool); ok {
+			return boolEquals(lb, rv), nil
+		}
+		if rb, ok := rv.(bool); ok {
+			return boolEquals(rb, lv), nil
+		}
+	}
+	switch {
+	case lt == syntax.Type_Bool:
+		return lv.(bool) == rv.(bool), nil
+	case isTemporal(lv) || isTemporal(rv):
+		// 时间 / 时长只与同类型的值相等
+		c, err := compareTemporal(lv, rv)
+		return err == nil && c == 0, nil
+	case lt == syntax.Type_Number || rt == syntax.Type_Number:
+		// 不能解析成数字的字符串与数字不相等
+		c, err := compareNumbers(lv, rv, decimal)
+		return err == nil && c == 0, nil
+	}
+	ls, lerr := cast.ToStringE(lv)
+	rs, rerr := cast.ToStringE(rv)
+	return lerr == nil && rerr == nil && ls == rs, nil
+}
+
+func listOperandError(lv, rv any) error {
+	v := lv
+	if syntax.InferType(v) != syntax.Type_List {
+		v = rv
+	}
+	return fmt.Errorf("cannot compare list \"%v\", use any() / all() / contains() for multi-valued parameters", v)
+}
+
+func boolEquals(b bool, v any) bool {
+	if syntax.InferType(v) != syntax.Type_String {
+		// 数字等其他类型不与 bool 相等
+		return false
+	}
+	vb, err := cast.ToBoolE(v)
+	return err == nil && vb == b
+}
+
+func typeName(t int) string {
+	switch t {
+	case syntax.Type_Bool:
+		return "bool"
+	case syntax.Type_Number:
+		return "number"
+	case syntax.Type_Time:
+		return "time"
+	case syntax.Type_Duration:
+		return "duration"
+	}
+	return "string"
 }
 
 // <
@@ -65,61 +162,20 @@ type ltSyntax struct {
 }
 
 func NewLtSyntax(left, right syntax.Syntax) syntax.Syntax {
-	return &ltSyntax{
+	s := &ltSyntax{
 		builtiOperSyntax{
-			priority: 50,
+			priority: syntax.PrecedenceRelational,
 			kind:     2,
 			left:     left,
 			right:    right,
-			evalute: func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
-
-				leftIfnerType := syntax.InferType(leftR.Value)
-				rightInferType := syntax.InferType(rightR.Value)
-				if leftIfnerType == syntax.Type_Number && leftIfnerType == rightInferType {
-					return syntax.SyntaxValue{
-						Type:  syntax.Type_Bool,
-						Value: cast.ToFloat32(leftR.Value) < cast.ToFloat32(rightR.Value),
-					}
-				}
-
-				// 尝试转换成 float32
-				if leftIfnerType == syntax.Type_String || rightInferType == syntax.Type_String {
-					leftFloat32V, err := cast.ToFloat32E(leftR.Value)
-					if err != nil {
-						return syntax.SyntaxValue{
-							Error:   err,
-							IsError: true,
-						}
-					}
-					rightFloat32V, err := cast.ToFloat32E(rightR.Value)
-					if err != nil {
-						return syntax.SyntaxValue{
-							Error:   err,
-							IsError: true,
-						}
-					}
-					return syntax.SyntaxValue{
-						Type:  syntax.Type_Bool,
-						Value: leftFloat32V < rightFloat32V,
-					}
-				}
-
-				// 左值不符合
-				if leftIfnerType != syntax.Type_Number {
-					return syntax.SyntaxValue{
-						IsError: true,
-						Error:   fmt.Errorf("expect number, but got \"%s\"", leftR.Value),
-					}
-				}
-
-				// 右值不符合
-				return syntax.SyntaxValue{
-					IsError: true,
-					Error:   fmt.Errorf("expect number, but got \"%s\"", rightR.Value),
-				}
-			},
 		},
 	}
+	s.evalute = func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
+		return compareEvaluate(leftR, rightR, &s.builtiOperSyntax, "<", func(c int) bool {
+			return c < 0
+		})
+	}
+	return s
 }
 
 // <=
@@ -129,61 +185,20 @@ type lteSyntax struct {
 }
 
 func NewLteSyntax(left, right syntax.Syntax) syntax.Syntax {
-	return &lteSyntax{
+	s := &lteSyntax{
 		builtiOperSyntax{
-			priority: 50,
+			priority: syntax.PrecedenceRelational,
 			kind:     2,
 			left:     left,
 			right:    right,
-			evalute: func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
-
-				leftIfnerType := syntax.InferType(leftR.Value)
-				rightInferType := syntax.InferType(rightR.Value)
-				if leftIfnerType == syntax.Type_Number && leftIfnerType == rightInferType {
-					return syntax.SyntaxValue{
-						Type:  syntax.Type_Bool,
-						Value: cast.ToFloat32(leftR.Value) <= cast.ToFloat32(rightR.Value),
-					}
-				}
-
-				// 尝试转换成 float32
-				if leftIfnerType == syntax.Type_String || rightInferType == syntax.Type_String {
-					leftFloat32V, err := cast.ToFloat32E(leftR.Value)
-					if err != nil {
-						return syntax.SyntaxValue{
-							Error:   err,
-							IsError: true,
-						}
-					}
-					rightFloat32V, err := cast.ToFloat32E(rightR.Value)
-					if err != nil {
-						return syntax.SyntaxValue{
-							Error:   err,
-							IsError: true,
-						}
-					}
-					return syntax.SyntaxValue{
-						Type:  syntax.Type_Bool,
-						Value: leftFloat32V <= rightFloat32V,
-					}
-				}
-
-				// 左值不符合
-				if leftIfnerType != syntax.Type_Number {
-					return syntax.SyntaxValue{
-						IsError: true,
-						Error:   fmt.Errorf("expect number, but got \"%s\"", leftR.Value),
-					}
-				}
-
-				// 右值不符合
-				return syntax.SyntaxValue{
-					IsError: true,
-					Error:   fmt.Errorf("expect number, but got \"%s\"", rightR.Value),
-				}
-			},
 		},
 	}
+	s.evalute = func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
+		return compareEvaluate(leftR, rightR, &s.builtiOperSyntax, "<=", func(c int) bool {
+			return c <= 0
+		})
+	}
+	return s
 }
 
 // >
@@ -193,60 +208,20 @@ type gtSyntax struct {
 }
 
 func NewGtSyntax(left, right syntax.Syntax) syntax.Syntax {
-	return &gtSyntax{
+	s := &gtSyntax{
 		builtiOperSyntax{
-			priority: 50,
+			priority: syntax.PrecedenceRelational,
 			kind:     2,
 			left:     left,
 			right:    right,
-			evalute: func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
-				leftIfnerType := syntax.InferType(leftR.Value)
-				rightInferType := syntax.InferType(rightR.Value)
-				if leftIfnerType == syntax.Type_Number && leftIfnerType == rightInferType {
-					return syntax.SyntaxValue{
-						Type:  syntax.Type_Bool,
-						Value: cast.ToFloat32(leftR.Value) > cast.ToFloat32(rightR.Value),
-					}
-				}
-
-				// 尝试转换成 float32
-				if leftIfnerType == syntax.Type_String || rightInferType == syntax.Type_String {
-					leftFloat32V, err := cast.ToFloat32E(leftR.Value)
-					if err != nil {
-						return syntax.SyntaxValue{
-							Error:   err,
-							IsError: true,
-						}
-					}
-					rightFloat32V, err := cast.ToFloat32E(rightR.Value)
-					if err != nil {
-						return syntax.SyntaxValue{
-							Error:   err,
-							IsError: true,
-						}
-					}
-					return syntax.SyntaxValue{
-						Type:  syntax.Type_Bool,
-						Value: leftFloat32V > rightFloat32V,
-					}
-				}
-
-				// 左值不符合
-				if leftIfnerType != syntax.Type_Number {
-					return syntax.SyntaxValue{
-						IsError: true,
-						Error:   fmt.Errorf("expect number, but got \"%s\"", leftR.Value),
-					}
-				}
-
-				// 右值不符合
-				return syntax.SyntaxValue{
-					IsError: true,
-					Error:   fmt.Errorf("expect number, but got \"%s\"", rightR.Value),
-				}
-			},
 		},
 	}
+	s.evalute = func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
+		return compareEvaluate(leftR, rightR, &s.builtiOperSyntax, ">", func(c int) bool {
+			return c > 0
+		})
+	}
+	return s
 }
 
 // >=
@@ -256,57 +231,18 @@ type gteSyntax struct {
 }
 
 func NewGteSyntax(left, right syntax.Syntax) syntax.Syntax {
-	return &gteSyntax{
+	s := &gteSyntax{
 		builtiOperSyntax{
-			priority: 50,
+			priority: syntax.PrecedenceRelational,
 			kind:     2,
 			left:     left,
 			right:    right,
-			evalute: func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
-				leftIfnerType := syntax.InferType(leftR.Value)
-				rightInferType := syntax.InferType(rightR.Value)
-				if leftIfnerType == syntax.Type_Number && leftIfnerType == rightInferType {
-					return syntax.SyntaxValue{
-						Type:  syntax.Type_Bool,
-						Value: cast.ToFloat32(leftR.Value) >= cast.ToFloat32(rightR.Value),
-					}
-				}
-
-				// 尝试转换成 float32
-				if leftIfnerType == syntax.Type_String || rightInferType == syntax.Type_String {
-					leftFloat32V, err := cast.ToFloat32E(leftR.Value)
-					if err != nil {
-						return syntax.SyntaxValue{
-							Error:   err,
-							IsError: true,
-						}
-					}
-					rightFloat32V, err := cast.ToFloat32E(rightR.Value)
-					if err != nil {
-						return syntax.SyntaxValue{
-							Error:   err,
-							IsError: true,
-						}
-					}
-					return syntax.SyntaxValue{
-						Type:  syntax.Type_Bool,
-						Value: leftFloat32V >= rightFloat32V,
-					}
-				}
-				// 左值不符合
-				if leftIfnerType != syntax.Type_Number {
-					return syntax.SyntaxValue{
-						IsError: true,
-						Error:   fmt.Errorf("expect number, but got \"%s\"", leftR.Value),
-					}
-				}
-
-				// 右值不符合
-				return syntax.SyntaxValue{
-					IsError: true,
-					Error:   fmt.Errorf("expect number, but got \"%s\"", rightR.Value),
-				}
-			},
 		},
 	}
+	s.evalute = func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
+		return compareEvaluate(leftR, rightR, &s.builtiOperSyntax, ">=", func(c int) bool {
+			return c >= 0
+		})
+	}
+	return s
 }
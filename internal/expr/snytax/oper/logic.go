@@ -1,6 +1,9 @@
 package oper
 
 import (
+	"fmt"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
 	syntax "github.com/einsitang/go-security/internal/expr/snytax"
 )
 
@@ -18,19 +21,23 @@ func (s *andSyntax) ReturnType() int {
 	return syntax.Type_Bool
 }
 
+// 短路求值: 左值为 false 时不再计算右值
+func (s *andSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
+	return shortCircuitEvaluate(s.left, s.right, c, false)
+}
+
+// 左值是否已能决定结果
+func (s *andSyntax) ShortCircuit(left any) bool {
+	return left == false
+}
+
 func NewAndSyntax(left, right syntax.Syntax) syntax.Syntax {
 	return &andSyntax{
 		builtiOperSyntax{
 			kind:     2,
-			priority: 60,
+			priority: syntax.PrecedenceAnd,
 			left:     left,
 			right:    right,
-			evalute: func(a, b syntax.SyntaxValue) syntax.SyntaxValue {
-				return syntax.SyntaxValue{
-					Type:  syntax.Type_Bool,
-					Value: a.Value.(bool) && b.Value.(bool),
-				}
-			},
 		},
 	}
 }
@@ -49,19 +56,55 @@ func (s *orSyntax) ReturnType() int {
 	return syntax.Type_Bool
 }
 
+// 短路求值: 左值为 true 时不再计算右值
+func (s *orSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
+	return shortCircuitEvaluate(s.left, s.right, c, true)
+}
+
+// 左值是否已能决定结果
+func (s *orSyntax) ShortCircuit(left any) bool {
+	return left == true
+}
+
 func NewOrSyntax(left, right syntax.Syntax) syntax.Syntax {
 	return &orSyntax{
 		builtiOperSyntax{
 			kind:     2,
-			priority: 60,
+			priority: syntax.PrecedenceOr,
 			left:     left,
 			right:    right,
-			evalute: func(a, b syntax.SyntaxValue) syntax.SyntaxValue {
-				return syntax.SyntaxValue{
-					Type:  syntax.Type_Bool,
-					Value: a.Value.(bool) || b.Value.(bool),
-				}
-			},
 		},
 	}
 }
+
+// 逻辑运算短路求值
+//
+// 左值等于 decided 时直接返回，不再计算右值，右值中的错误也不会出现
+//
+// 左值出错 或 不是 bool 时直接返回错误，不会由右值决定结果
+func shortCircuitEvaluate(left, right syntax.Syntax, c *ctx.Context, decided bool) syntax.SyntaxValue {
+	lv, err := expectBool(left.Evaluate(c))
+	if err != nil {
+		return syntax.SyntaxValue{IsError: true, Error: err}
+	}
+	if lv == decided {
+		return syntax.SyntaxValue{Type: syntax.Type_Bool, Value: decided}
+	}
+
+	rv, err := expectBool(right.Evaluate(c))
+	if err != nil {
+		return syntax.SyntaxValue{IsError: true, Error: err}
+	}
+	return syntax.SyntaxValue{Type: syntax.Type_Bool, Value: rv}
+}
+
+func expectBool(v syntax.SyntaxValue) (bool, error) {
+	if v.IsError {
+		return false, v.Error
+	}
+	b, ok := v.Value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expect bool, but got \"%v\"", v.Value)
+	}
+	return b, nil
+}
@@ -2,40 +2,106 @@ package oper
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
 	syntax "github.com/einsitang/go-security/internal/expr/snytax"
 	"github.com/spf13/cast"
 )
 
+// 运算结果类型，由左右值的类型在解析时确定，如 时间 - 时间 为时长
+func arithmeticReturnType(symbol string, left, right syntax.Syntax) int {
+	if left == nil || right == nil {
+		return syntax.Type_Number
+	}
+	if t := arithmeticType(symbol, left.ReturnType(), right.ReturnType()); t != 0 {
+		return t
+	}
+	return syntax.Type_Number
+}
+
 // + add addition
+//
+// 任意一侧为字符串(如字符串常量) 时为字符串拼接: 'orders.' + $tenant
 type addSyntax struct {
 	builtiOperSyntax
 }
 
 func (s *addSyntax) InputType() int {
-	return syntax.Type_Number
+	return syntax.Type_Number | syntax.Type_String | syntax.Type_Time | syntax.Type_Duration
+}
+
+// 左右值类型检查: 数字 / 字符串拼接 / 时间运算
+func (s *addSyntax) AcceptTypes(left, right int) bool {
+	if arithmeticType("+", left, right) != 0 {
+		return true
+	}
+	return left != syntax.Type_Null && right != syntax.Type_Null && left&right&syntax.Type_String != 0
 }
 
 // 支持的出参类型,具体结果得执行 Evaluate 运行后得出
 func (s *addSyntax) ReturnType() int {
-	return syntax.Type_Number
+	if s.concat() {
+		return syntax.Type_String
+	}
+	return arithmeticReturnType("+", s.left, s.right)
+}
+
+// 是否字符串拼接, 由左右值的类型在解析时确定
+func (s *addSyntax) concat() bool {
+	if s.left == nil || s.right == nil {
+		return false
+	}
+	return s.left.ReturnType() == syntax.Type_String || s.right.ReturnType() == syntax.Type_String
 }
+
 func NewAddSyntax(left, right syntax.Syntax) syntax.Syntax {
-	return &addSyntax{
+	s := &addSyntax{
 		builtiOperSyntax{
 			kind:     2,
-			priority: 35,
+			priority: syntax.PrecedenceAdditive,
 			left:     left,
 			right:    right,
-			evalute: func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
-				return mathEvaluate(leftR, rightR, func(a, b int) int {
-					return a + b
-				}, func(a, b float32) float32 {
-					return a + b
-				})
-			},
 		},
 	}
+	s.evalute = func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
+		if s.concat() {
+			return concatEvaluate(leftR, rightR)
+		}
+		return mathEvaluate(leftR, rightR, s.decimal, addition)
+	}
+	return s
+}
+
+// 字符串拼接, 数字会转换成字符串, null / bool 返回错误
+func concatEvaluate(lr, rr syntax.SyntaxValue) syntax.SyntaxValue {
+	var b strings.Builder
+	for _, v := range []any{lr.Value, rr.Value} {
+		switch v.(type) {
+		case nil:
+			return syntax.SyntaxValue{
+				Error:   errors.New("cannot concatenate null"),
+				IsError: true,
+			}
+		case bool:
+			return syntax.SyntaxValue{
+				Error:   fmt.Errorf("cannot concatenate \"%v\"", v),
+				IsError: true,
+			}
+		}
+		str, err := cast.ToStringE(v)
+		if err != nil {
+			return syntax.SyntaxValue{
+				Error:   err,
+				IsError: true,
+			}
+		}
+		b.WriteString(str)
+	}
+	return syntax.SyntaxValue{
+		Type:  syntax.Type_String,
+		Value: b.String(),
+	}
 }
 
 // - sub subtraction
@@ -44,30 +110,31 @@ type subSyntax struct {
 }
 
 func (s *subSyntax) InputType() int {
-	return syntax.Type_Number
+	return syntax.Type_Number | syntax.Type_Time | syntax.Type_Duration
+}
+
+func (s *subSyntax) AcceptTypes(left, right int) bool {
+	return arithmeticType("-", left, right) != 0
 }
 
 // 支持的出参类型,具体结果得执行 Evaluate 运行后得出
 func (s *subSyntax) ReturnType() int {
-	return syntax.Type_Number
+	return arithmeticReturnType("-", s.left, s.right)
 }
 
 func NewSubSyntax(left, right syntax.Syntax) syntax.Syntax {
-	return &subSyntax{
+	s := &subSyntax{
 		builtiOperSyntax{
 			kind:     2,
-			priority: 35,
+			priority: syntax.PrecedenceAdditive,
 			left:     left,
 			right:    right,
-			evalute: func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
-				return mathEvaluate(leftR, rightR, func(a, b int) int {
-					return a - b
-				}, func(a, b float32) float32 {
-					return a - b
-				})
-			},
 		},
 	}
+	s.evalute = func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
+		return mathEvaluate(leftR, rightR, s.decimal, subtraction)
+	}
+	return s
 }
 
 // * mul multiply
@@ -76,65 +143,71 @@ type mulSyntax struct {
 }
 
 func (s *mulSyntax) InputType() int {
-	return syntax.Type_Number
+	return syntax.Type_Number | syntax.Type_Time | syntax.Type_Duration
+}
+
+func (s *mulSyntax) AcceptTypes(left, right int) bool {
+	return arithmeticType("*", left, right) != 0
 }
 
 // 支持的出参类型,具体结果得执行 Evaluate 运行后得出
 func (s *mulSyntax) ReturnType() int {
-	return syntax.Type_Number
+	return arithmeticReturnType("*", s.left, s.right)
 }
 
 func NewMulSyntax(left, right syntax.Syntax) syntax.Syntax {
-	return &mulSyntax{
+	s := &mulSyntax{
 		builtiOperSyntax{
 			kind:     2,
-			priority: 30,
+			priority: syntax.PrecedenceMultiplicative,
 			left:     left,
 			right:    right,
-			evalute: func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
-				return mathEvaluate(leftR, rightR, func(a, b int) int {
-					return a * b
-				}, func(a, b float32) float32 {
-					return a * b
-				})
-			},
 		},
 	}
+	s.evalute = func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
+		return mathEvaluate(leftR, rightR, s.decimal, multiplication)
+	}
+	return s
 }
 
 // / div division
+//
+// 两侧都是整数时取整，除数为 0 时返回 ErrDivisionByZero
 type divSyntax struct {
 	builtiOperSyntax
 }
 
 func (s *divSyntax) InputType() int {
-	return syntax.Type_Number
+	return syntax.Type_Number | syntax.Type_Time | syntax.Type_Duration
+}
+
+func (s *divSyntax) AcceptTypes(left, right int) bool {
+	return arithmeticType("/", left, right) != 0
 }
 
 // 支持的出参类型,具体结果得执行 Evaluate 运行后得出
 func (s *divSyntax) ReturnType() int {
-	return syntax.Type_Number
+	return arithmeticReturnType("/", s.left, s.right)
 }
 
 func NewDivSyntax(left, right syntax.Syntax) syntax.Syntax {
-	return &divSyntax{
+	s := &divSyntax{
 		builtiOperSyntax{
 			kind:     2,
-			priority: 30,
+			priority: syntax.PrecedenceMultiplicative,
 			left:     left,
 			right:    right,
-			evalute: func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
-				return mathEvaluate(leftR, rightR, func(a, b int) int {
-					return a / b
-				}, func(a, b float32) float32 {
-					return a / b
-				})
-			},
 		},
 	}
+	s.evalute = func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
+		return mathEvaluate(leftR, rightR, s.decimal, division)
+	}
+	return s
 }
 
 // % mod modulo
+//
+// 只支持整数
 type modSyntax struct {
 	builtiOperSyntax
 }
@@ -149,68 +222,16 @@ func (s *modSyntax) ReturnType() int {
 }
 
 func NewModSyntax(left, right syntax.Syntax) syntax.Syntax {
-	return &modSyntax{
+	s := &modSyntax{
 		builtiOperSyntax{
 			kind:     2,
-			priority: 30,
+			priority: syntax.PrecedenceMultiplicative,
 			left:     left,
 			right:    right,
-			evalute: func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
-				return mathEvaluate(leftR, rightR, func(a, b int) int {
-					return a % b
-				}, func(a, b float32) float32 {
-					panic("type error, modulo not support float number")
-				})
-			},
 		},
 	}
-}
-
-type intFn func(a, b int) int
-type floatFn func(a, b float32) float32
-
-func mathEvaluate(lr, rr syntax.SyntaxValue, iCallback intFn, fCallback floatFn) syntax.SyntaxValue {
-	leftIfnerType := syntax.InferType(lr.Value)
-	rightInferType := syntax.InferType(rr.Value)
-	if leftIfnerType == syntax.Type_Number && leftIfnerType == rightInferType {
-		// 具体值
-		switch lr.Value.(type) {
-		case int:
-			return syntax.SyntaxValue{
-				Type:  syntax.Type_Number,
-				Value: iCallback(lr.Value.(int), rr.Value.(int)),
-			}
-		case float32:
-			return syntax.SyntaxValue{
-				Type:  syntax.Type_Number,
-				Value: fCallback(lr.Value.(float32), rr.Value.(float32)),
-			}
-		}
-	}
-	// 转型补丁
-	if leftIfnerType == syntax.Type_String || rightInferType == syntax.Type_String {
-		// 尝试转换成 float32 计算
-		leftFloat32V, err := cast.ToFloat32E(lr.Value)
-		if err != nil {
-			return syntax.SyntaxValue{
-				Error:   errors.New("invalid types"),
-				IsError: true,
-			}
-		}
-		rightFloat32V, err := cast.ToFloat32E(rr.Value)
-		if err != nil {
-			return syntax.SyntaxValue{
-				Error:   errors.New("invalid types"),
-				IsError: true,
-			}
-		}
-		return syntax.SyntaxValue{
-			Type:  syntax.Type_Number,
-			Value: fCallback(leftFloat32V, rightFloat32V),
-		}
-	}
-	return syntax.SyntaxValue{
-		Error:   errors.New("invalid types"),
-		IsError: true,
+	s.evalute = func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
+		return mathEvaluate(leftR, rightR, s.decimal, modulo)
 	}
+	return s
 }
@@ -0,0 +1,308 @@
+package oper
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cast"
+
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+)
+
+// in
+// membership syntax
+type inSyntax struct {
+	builtiOperSyntax
+}
+
+// 左值可以是任意值(包括 null)
+func (s *inSyntax) InputType() int {
+	return syntax.Type_Bool | syntax.Type_Number | syntax.Type_String | syntax.Type_Null
+}
+
+// 右值必须是列表
+func (s *inSyntax) RightInputType() int {
+	return syntax.Type_List
+}
+
+func NewInSyntax(left, right syntax.Syntax) syntax.Syntax {
+	s := &inSyntax{
+		builtiOperSyntax{
+			priority: syntax.PrecedenceEquality,
+			kind:     2,
+			left:     left,
+			right:    right,
+		},
+	}
+	s.evalute = func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
+		return membershipEvaluate(leftR, rightR, &s.builtiOperSyntax, false)
+	}
+	return s
+}
+
+// not in
+// not membership syntax
+type notInSyntax struct {
+	builtiOperSyntax
+}
+
+// 左值可以是任意值(包括 null)
+func (s *notInSyntax) InputType() int {
+	return syntax.Type_Bool | syntax.Type_Number | syntax.Type_String | syntax.Type_Null
+}
+
+// 右值必须是列表
+func (s *notInSyntax) RightInputType() int {
+	return syntax.Type_List
+}
+
+func NewNotInSyntax(left, right syntax.Syntax) syntax.Syntax {
+	s := &notInSyntax{
+		builtiOperSyntax{
+			priority: syntax.PrecedenceEquality,
+			kind:     2,
+			left:     left,
+			right:    right,
+		},
+	}
+	s.evalute = func(leftR, rightR syntax.SyntaxValue) syntax.SyntaxValue {
+		return membershipEvaluate(leftR, rightR, &s.builtiOperSyntax, true)
+	}
+	return s
+}
+
+func membershipEvaluate(leftR, rightR syntax.SyntaxValue, s *builtiOperSyntax, negate bool) syntax.SyntaxValue {
+	list, ok := rightR.Value.(*syntax.List)
+	if !ok {
+		return syntax.SyntaxValue{
+			IsError: true,
+			Error:   fmt.Errorf("expect list, but got \"%v\"", rightR.Value),
+		}
+	}
+	found, err := Contains(list, leftR.Value, s.decimal, s.strict)
+	if err != nil {
+		return syntax.SyntaxValue{
+			IsError: true,
+			Error:   err,
+		}
+	}
+	return syntax.SyntaxValue{
+		Type:  syntax.Type_Bool,
+		Value: found != negate,
+	}
+}
+
+// 列表是否包含 v
+//
+// 按 == 的规则比较，相当于 v == item1 or v == item2 ... : 找到相等的元素即返回 true ，
+// 在此之前比较出错(如严格模式下类型不同)时返回错误。
+// 列表常量使用解析时构建的索引，其他列表(如重复的查询参数) 逐个比较
+func Contains(list any, v any, decimal, strict bool) (bool, error) {
+	if syntax.InferType(v) == syntax.Type_List {
+		return false, fmt.Errorf("expect single value, but got list \"%v\", use any() / all() for multi-valued parameters", v)
+	}
+	if l, ok := list.(*syntax.List); ok && l.Index() != nil {
+		return l.Index().Contains(v, decimal, strict)
+	}
+	items, _ := syntax.ListItems(list)
+	return scanItems(items, v, decimal, strict)
+}
+
+func scanItems(items []any, v any, decimal, strict bool) (bool, error) {
+	for _, item := range items {
+		eq, err := equals(v, item, decimal, strict)
+		if err != nil {
+			return false, err
+		}
+		if eq {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// 列表常量的成员索引，值为元素第一次出现的下标
+//
+// 数字按数值建索引(如 1 与 1.0 相同)，十进制模式单独一份；与 == 一样，
+// 数字字符串按数值、'true' / 'false' 按 bool 与其他类型的值比较。
+// 只有 v 不是 null / 字符串 / 数字 / bool / 时间 / 时长时才逐个比较
+type listIndex struct {
+	items []any
+	// 字符串元素
+	strs map[string]int
+	// bool 元素
+	bools map[bool]int
+	// 数字元素，按 numberKey 建索引
+	nums, decimalNums map[string]int
+	// 能解析成数字的字符串元素
+	numStrs, decimalNumStrs map[string]int
+	// 能转换为 bool 的字符串元素
+	boolStrs map[bool]int
+	// 第一个 null 元素
+	null int
+	// 每种类型第一个元素，严格模式下判断在命中之前是否有类型不同的元素
+	firstOfType map[int]int
+}
+
+func NewListIndex(items []any) syntax.Index {
+	ix := &listIndex{
+		items:          items,
+		strs:           map[string]int{},
+		bools:          map[bool]int{},
+		nums:           map[string]int{},
+		decimalNums:    map[string]int{},
+		numStrs:        map[string]int{},
+		decimalNumStrs: map[string]int{},
+		boolStrs:       map[bool]int{},
+		null:           -1,
+		firstOfType:    map[int]int{},
+	}
+	for i, item := range items {
+		if item == nil {
+			if ix.null < 0 {
+				ix.null = i
+			}
+			continue
+		}
+		t := syntax.InferType(item)
+		setFirst(ix.firstOfType, t, i)
+		switch v := item.(type) {
+		case bool:
+			setFirst(ix.bools, v, i)
+		case string:
+			setFirst(ix.strs, v, i)
+			if key, ok := numberKey(v, false); ok {
+				setFirst(ix.numStrs, key, i)
+			}
+			if key, ok := numberKey(v, true); ok {
+				setFirst(ix.decimalNumStrs, key, i)
+			}
+			if b, err := cast.ToBoolE(v); err == nil {
+				setFirst(ix.boolStrs, b, i)
+			}
+		default:
+			if key, ok := numberKey(v, false); ok {
+				setFirst(ix.nums, key, i)
+			}
+			if key, ok := numberKey(v, true); ok {
+				setFirst(ix.decimalNums, key, i)
+			}
+		}
+	}
+	return ix
+}
+
+func (ix *listIndex) Contains(v any, decimal, strict bool) (bool, error) {
+	if v == nil {
+		// 与 null 比较不受严格模式影响
+		return ix.null >= 0, nil
+	}
+
+	// 第一个相等元素的下标
+	match := -1
+	switch val := v.(type) {
+	case bool:
+		match = lookup(ix.bools, val)
+		if !strict {
+			match = firstOf(match, lookup(ix.boolStrs, val))
+		}
+	case string:
+		match = lookup(ix.strs, val)
+		if !strict {
+			if key, ok := numberKey(val, decimal); ok {
+				match = firstOf(match, lookup(ix.numbers(decimal), key))
+			}
+			if b, err := cast.ToBoolE(val); err == nil {
+				match = firstOf(match, lookup(ix.bools, b))
+			}
+		}
+	case time.Time, time.Duration:
+		// 时间 / 时长与列表中的常量永远不相等
+	default:
+		if syntax.InferType(v) != syntax.Type_Number {
+			// 其他类型的值按 == 的转换规则逐个比较
+			return scanItems(ix.items, v, decimal, strict)
+		}
+		_, isRat := v.(*big.Rat)
+		exact := decimal || isRat
+		if key, ok := numberKey(v, exact); ok {
+			match = lookup(ix.numbers(exact), key)
+			if !strict {
+				match = firstOf(match, lookup(ix.numberStrings(exact), key))
+			}
+		}
+	}
+
+	if strict {
+		// 命中之前与类型不同的元素比较会出错
+		t := syntax.InferType(v)
+		mismatch := -1
+		for itemType, i := range ix.firstOfType {
+			if itemType != t {
+				mismatch = firstOf(mismatch, i)
+			}
+		}
+		if mismatch >= 0 && (match < 0 || mismatch < match) {
+			return equals(v, ix.items[mismatch], decimal, strict)
+		}
+	}
+	return match >= 0, nil
+}
+
+func (ix *listIndex) numbers(decimal bool) map[string]int {
+	if decimal {
+		return ix.decimalNums
+	}
+	return ix.nums
+}
+
+func (ix *listIndex) numberStrings(decimal bool) map[string]int {
+	if decimal {
+		return ix.decimalNumStrs
+	}
+	return ix.numStrs
+}
+
+// 数字的索引键，按 compareNumbers 数值相等的数字键相同
+func numberKey(v any, decimal bool) (string, bool) {
+	n, err := toNumber(v, decimal)
+	if err != nil {
+		return "", false
+	}
+	switch n := n.(type) {
+	case int64:
+		return strconv.FormatInt(n, 10), true
+	case *big.Rat:
+		// 整数的 RatString 与 FormatInt 相同
+		return n.RatString(), true
+	}
+	f := n.(float64)
+	if isInt64(f) {
+		// 与整数比较时按 int64 比较，见 compareFloat
+		return strconv.FormatInt(int64(f), 10), true
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64), true
+}
+
+func setFirst[K comparable](m map[K]int, k K, i int) {
+	if _, ok := m[k]; !ok {
+		m[k] = i
+	}
+}
+
+func lookup[K comparable](m map[K]int, k K) int {
+	if i, ok := m[k]; ok {
+		return i
+	}
+	return -1
+}
+
+// 两个下标中较小的一个，-1 表示不存在
+func firstOf(a, b int) int {
+	if a < 0 || b >= 0 && b < a {
+		return b
+	}
+	return a
+}
@@ -54,15 +54,22 @@ func (s *negateSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
 			Error:   evalV.Error,
 		}
 	}
+	b, err := expectBool(evalV)
+	if err != nil {
+		return syntax.SyntaxValue{
+			IsError: true,
+			Error:   err,
+		}
+	}
 	return syntax.SyntaxValue{
 		Type:  syntax.Type_Bool,
-		Value: !s.val.Evaluate(c).Value.(bool),
+		Value: !b,
 	}
 }
 
 func NewNegateSyntax(val syntax.Syntax) syntax.Syntax {
 	return &negateSyntax{
-		priority: 20,
+		priority: syntax.PrecedenceNegate,
 		kind:     1,
 		val:      val,
 	}
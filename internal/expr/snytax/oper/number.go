@@ -0,0 +1,438 @@
+package oper
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+)
+
+// 数值运算
+//
+// 两侧都是整数时按 int64 精确计算，溢出时返回 ErrOverflow ；否则按 float64 计算
+//
+// 十进制模式下小数转换成 *big.Rat 按十进制精确计算，如 0.1 + 0.2 == 0.3 ，除法也不再取整
+
+var (
+	// 除数为 0
+	ErrDivisionByZero = errors.New("division by zero")
+	// 数值溢出
+	ErrOverflow = errors.New("numeric overflow")
+	// 严格模式下比较的两侧类型不同
+	ErrTypeMismatch = errors.New("mismatched types")
+	// 数值运算 / 大小比较的操作数为 null
+	ErrNullOperand = errors.New("null operand")
+)
+
+// 十进制模式，由解析器在创建运算 / 比较语句时设置
+type Decimal interface {
+	SetDecimal()
+}
+
+// 严格类型模式，由解析器在创建比较语句时设置
+type StrictTypes interface {
+	SetStrictTypes()
+}
+
+// 转换成 int64 / float64 / *big.Rat
+//
+// 数字字符串(如路径参数 "123") 会被解析，null 返回 ErrNullOperand ；十进制模式下小数转换成 *big.Rat
+func toNumber(v any, decimal bool) (any, error) {
+	var f float64
+	switch v := v.(type) {
+	case nil:
+		return nil, ErrNullOperand
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return uintToNumber(uint64(v))
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return uintToNumber(v)
+	case *big.Rat:
+		return v, nil
+	case float32:
+		if decimal {
+			// 按 float32 的最短十进制表示转换，避免 0.1 变成 0.100000001490116...
+			return decimalOf(strconv.FormatFloat(float64(v), 'g', -1, 32))
+		}
+		f = float64(v)
+	case float64:
+		f = v
+	case string:
+		s := strings.TrimSpace(v)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		parsed, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsInf(parsed, 0) || math.IsNaN(parsed) {
+			return nil, fmt.Errorf("expect number, but got \"%s\"", v)
+		}
+		if decimal {
+			return decimalOf(s)
+		}
+		f = parsed
+	default:
+		return nil, fmt.Errorf("expect number, but got \"%v\"", v)
+	}
+
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, fmt.Errorf("expect number, but got \"%v\"", f)
+	}
+	if decimal {
+		return decimalOf(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return f, nil
+}
+
+func uintToNumber(v uint64) (any, error) {
+	if v > math.MaxInt64 {
+		return nil, fmt.Errorf("%w: %d", ErrOverflow, v)
+	}
+	return int64(v), nil
+}
+
+func decimalOf(s string) (any, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("expect number, but got \"%s\"", s)
+	}
+	return r, nil
+}
+
+// 两侧转换成相同类型: 都是 int64 , 或提升为 *big.Rat / float64
+func toNumbers(lv, rv any, decimal bool) (any, any, error) {
+	l, err := toNumber(lv, decimal)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := toNumber(rv, decimal)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, lInt := l.(int64)
+	_, rInt := r.(int64)
+	if lInt && rInt {
+		return l, r, nil
+	}
+	_, lRat := l.(*big.Rat)
+	_, rRat := r.(*big.Rat)
+	if lRat || rRat {
+		return toRat(l), toRat(r), nil
+	}
+	return toFloat(l), toFloat(r), nil
+}
+
+func toRat(n any) *big.Rat {
+	switch n := n.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(n)
+	case float64:
+		r, _ := new(big.Rat).SetString(strconv.FormatFloat(n, 'g', -1, 64))
+		return r
+	}
+	return n.(*big.Rat)
+}
+
+func toFloat(n any) float64 {
+	if i, ok := n.(int64); ok {
+		return float64(i)
+	}
+	return n.(float64)
+}
+
+// 双元运算
+type arithmetic struct {
+	symbol string
+	int    func(a, b int64) (int64, error)
+	float  func(a, b float64) (float64, error)
+	rat    func(a, b *big.Rat) (*big.Rat, error)
+	// 十进制模式下两侧都是整数时也按 *big.Rat 计算，如除法
+	exact bool
+}
+
+func mathEvaluate(lr, rr syntax.SyntaxValue, decimal bool, op arithmetic) syntax.SyntaxValue {
+	v, err := calculate(lr.Value, rr.Value, decimal, op)
+	if err != nil {
+		return syntax.SyntaxValue{
+			Error:   err,
+			IsError: true,
+		}
+	}
+	return syntax.SyntaxValue{
+		Type:  syntax.InferType(v),
+		Value: v,
+	}
+}
+
+func calculate(lv, rv any, decimal bool, op arithmetic) (any, error) {
+	if err := nullOperand(lv, rv, op.symbol); err != nil {
+		return nil, err
+	}
+	if isTemporal(lv) || isTemporal(rv) {
+		return temporalCalculate(lv, rv, op)
+	}
+	l, r, err := toNumbers(lv, rv, decimal)
+	if err != nil {
+		return nil, err
+	}
+
+	switch l := l.(type) {
+	case int64:
+		if !decimal || !op.exact {
+			return op.int(l, r.(int64))
+		}
+		result, err := op.rat(toRat(l), toRat(r))
+		if err != nil {
+			return nil, err
+		}
+		return normalizeRat(result), nil
+	case *big.Rat:
+		result, err := op.rat(l, r.(*big.Rat))
+		if err != nil {
+			return nil, err
+		}
+		return normalizeRat(result), nil
+	}
+
+	result, err := op.float(l.(float64), r.(float64))
+	if err != nil {
+		return nil, err
+	}
+	if math.IsInf(result, 0) || math.IsNaN(result) {
+		return nil, fmt.Errorf("%w: %v %s %v", ErrOverflow, l, op.symbol, r)
+	}
+	return result, nil
+}
+
+// 结果为整数时转换回 int64
+func normalizeRat(r *big.Rat) any {
+	if r.IsInt() && r.Num().IsInt64() {
+		return r.Num().Int64()
+	}
+	return r
+}
+
+var (
+	addition = arithmetic{
+		symbol: "+",
+		int: func(a, b int64) (int64, error) {
+			c := a + b
+			if (c > a) != (b > 0) {
+				return 0, fmt.Errorf("%w: %d + %d", ErrOverflow, a, b)
+			}
+			return c, nil
+		},
+		float: func(a, b float64) (float64, error) {
+			return a + b, nil
+		},
+		rat: func(a, b *big.Rat) (*big.Rat, error) {
+			return new(big.Rat).Add(a, b), nil
+		},
+	}
+
+	subtraction = arithmetic{
+		symbol: "-",
+		int: func(a, b int64) (int64, error) {
+			c := a - b
+			if (c < a) != (b > 0) {
+				return 0, fmt.Errorf("%w: %d - %d", ErrOverflow, a, b)
+			}
+			return c, nil
+		},
+		float: func(a, b float64) (float64, error) {
+			return a - b, nil
+		},
+		rat: func(a, b *big.Rat) (*big.Rat, error) {
+			return new(big.Rat).Sub(a, b), nil
+		},
+	}
+
+	multiplication = arithmetic{
+		symbol: "*",
+		int: func(a, b int64) (int64, error) {
+			if a == 0 || b == 0 {
+				return 0, nil
+			}
+			c := a * b
+			if c/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+				return 0, fmt.Errorf("%w: %d * %d", ErrOverflow, a, b)
+			}
+			return c, nil
+		},
+		float: func(a, b float64) (float64, error) {
+			return a * b, nil
+		},
+		rat: func(a, b *big.Rat) (*big.Rat, error) {
+			return new(big.Rat).Mul(a, b), nil
+		},
+	}
+
+	// 整数除法取整；十进制模式下精确计算
+	division = arithmetic{
+		symbol: "/",
+		int: func(a, b int64) (int64, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("%w: %d / %d", ErrDivisionByZero, a, b)
+			}
+			if a == math.MinInt64 && b == -1 {
+				return 0, fmt.Errorf("%w: %d / %d", ErrOverflow, a, b)
+			}
+			return a / b, nil
+		},
+		float: func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("%w: %v / %v", ErrDivisionByZero, a, b)
+			}
+			return a / b, nil
+		},
+		rat: func(a, b *big.Rat) (*big.Rat, error) {
+			if b.Sign() == 0 {
+				return nil, fmt.Errorf("%w: %s / %s", ErrDivisionByZero, a.RatString(), b.RatString())
+			}
+			return new(big.Rat).Quo(a, b), nil
+		},
+		exact: true,
+	}
+
+	// 只支持整数
+	modulo = arithmetic{
+		symbol: "%",
+		int: func(a, b int64) (int64, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("%w: %d %% %d", ErrDivisionByZero, a, b)
+			}
+			if b == -1 {
+				// math.MinInt64 % -1 同样为 0
+				return 0, nil
+			}
+			return a % b, nil
+		},
+		float: func(a, b float64) (float64, error) {
+			return 0, fmt.Errorf("modulo not support float number: %v %% %v", a, b)
+		},
+		rat: func(a, b *big.Rat) (*big.Rat, error) {
+			return nil, fmt.Errorf("modulo not support float number: %s %% %s", a.RatString(), b.RatString())
+		},
+	}
+)
+
+// 比较两个数字，返回 -1 / 0 / 1
+func compareNumbers(lv, rv any, decimal bool) (int, error) {
+	l, r, err := toNumbers(lv, rv, decimal)
+	if err != nil {
+		return 0, err
+	}
+	switch l := l.(type) {
+	case int64:
+		return cmp.Compare(l, r.(int64)), nil
+	case *big.Rat:
+		return l.Cmp(r.(*big.Rat)), nil
+	}
+	return compareFloat(lv, rv, l.(float64), r.(float64)), nil
+}
+
+// 整数与小数比较时，小数为整数值则按 int64 比较，避免大整数转换成 float64 时丢失精度
+func compareFloat(lv, rv any, l, r float64) int {
+	li, lInt := toInt64(lv)
+	ri, rInt := toInt64(rv)
+	switch {
+	case lInt && isInt64(r):
+		return cmp.Compare(li, int64(r))
+	case rInt && isInt64(l):
+		return cmp.Compare(int64(l), ri)
+	}
+	return cmp.Compare(l, r)
+}
+
+func toInt64(v any) (int64, bool) {
+	n, err := toNumber(v, false)
+	if err != nil {
+		return 0, false
+	}
+	i, ok := n.(int64)
+	return i, ok
+}
+
+// 是否可以无损转换成 int64 的整数值
+func isInt64(f float64) bool {
+	return f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64
+}
+
+// 严格模式下两侧都必须是数字，数字字符串(如路径参数 "123") 也会返回 ErrTypeMismatch
+func compareEvaluate(lr, rr syntax.SyntaxValue, s *builtiOperSyntax, symbol string, match func(c int) bool) syntax.SyntaxValue {
+	if err := nullOperand(lr.Value, rr.Value, symbol); err != nil {
+		return syntax.SyntaxValue{
+			Error:   err,
+			IsError: true,
+		}
+	}
+	if isTemporal(lr.Value) || isTemporal(rr.Value) {
+		c, err := compareTemporal(lr.Value, rr.Value)
+		if err != nil {
+			return syntax.SyntaxValue{
+				Error:   err,
+				IsError: true,
+			}
+		}
+		return syntax.SyntaxValue{
+			Type:  syntax.Type_Bool,
+			Value: match(c),
+		}
+	}
+	if s.strict {
+		for _, v := range []any{lr.Value, rr.Value} {
+			if syntax.InferType(v) != syntax.Type_Number {
+				return syntax.SyntaxValue{
+					Error:   fmt.Errorf("%w: expect number, but got \"%v\"", ErrTypeMismatch, v),
+					IsError: true,
+				}
+			}
+		}
+	}
+	c, err := compareNumbers(lr.Value, rr.Value, s.decimal)
+	if err != nil {
+		return syntax.SyntaxValue{
+			Error:   err,
+			IsError: true,
+		}
+	}
+	return syntax.SyntaxValue{
+		Type:  syntax.Type_Bool,
+		Value: match(c),
+	}
+}
+
+// null 不按 0 处理，避免 $quota < 10 在 quota 不存在时成立；需要默认值时使用 $quota ?? 0
+func nullOperand(lv, rv any, symbol string) error {
+	if lv != nil && rv != nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s %s, use ?? to provide a default value", ErrNullOperand, nullString(lv), symbol, nullString(rv))
+}
+
+func nullString(v any) string {
+	if v == nil {
+		return "null"
+	}
+	return fmt.Sprintf("\"%v\"", v)
+}
@@ -0,0 +1,139 @@
+package oper
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"time"
+
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+)
+
+// 时间运算
+//
+//	时间 ± 时长 => 时间 ; 时长 + 时间 => 时间 ; 时间 - 时间 => 时长
+//	时长 ± 时长 => 时长 ; 时长 * 数字 / 数字 * 时长 => 时长 ; 时长 / 数字 => 时长
+//
+// 时间之间、时长之间可以比较大小，时间 / 时长与其他类型比较时返回 ErrTypeMismatch
+
+// 是否时间或时长
+func isTemporal(v any) bool {
+	switch v.(type) {
+	case time.Time, time.Duration:
+		return true
+	}
+	return false
+}
+
+// 时间运算的结果类型，不支持的组合返回 0
+func temporalType(symbol string, left, right int) int {
+	switch symbol {
+	case "+":
+		switch {
+		case left == syntax.Type_Time && right == syntax.Type_Duration, left == syntax.Type_Duration && right == syntax.Type_Time:
+			return syntax.Type_Time
+		case left == syntax.Type_Duration && right == syntax.Type_Duration:
+			return syntax.Type_Duration
+		}
+	case "-":
+		switch {
+		case left == syntax.Type_Time && right == syntax.Type_Duration:
+			return syntax.Type_Time
+		case left == syntax.Type_Time && right == syntax.Type_Time, left == syntax.Type_Duration && right == syntax.Type_Duration:
+			return syntax.Type_Duration
+		}
+	case "*":
+		if left == syntax.Type_Duration && right == syntax.Type_Number || left == syntax.Type_Number && right == syntax.Type_Duration {
+			return syntax.Type_Duration
+		}
+	case "/":
+		if left == syntax.Type_Duration && right == syntax.Type_Number {
+			return syntax.Type_Duration
+		}
+	}
+	return 0
+}
+
+// 运算结果可能的类型，left / right 为左右值可能的类型；不支持的组合返回 0
+//
+// 数字之间的运算结果为数字，时间 / 时长见 temporalType
+func arithmeticType(symbol string, left, right int) int {
+	if left == syntax.Type_Null || right == syntax.Type_Null {
+		return 0
+	}
+	t := left & right & syntax.Type_Number
+	for _, l := range []int{syntax.Type_Number, syntax.Type_Time, syntax.Type_Duration} {
+		for _, r := range []int{syntax.Type_Number, syntax.Type_Time, syntax.Type_Duration} {
+			if left&l != 0 && right&r != 0 {
+				t |= temporalType(symbol, l, r)
+			}
+		}
+	}
+	return t
+}
+
+// 时间 / 时长运算
+func temporalCalculate(lv, rv any, op arithmetic) (any, error) {
+	lt, rt := syntax.InferType(lv), syntax.InferType(rv)
+	if temporalType(op.symbol, lt, rt) == 0 {
+		return nil, fmt.Errorf("%w: cannot calculate \"%v\" %s \"%v\"", ErrTypeMismatch, lv, op.symbol, rv)
+	}
+
+	switch l := lv.(type) {
+	case time.Time:
+		switch r := rv.(type) {
+		case time.Time:
+			return l.Sub(r), nil
+		case time.Duration:
+			if op.symbol == "-" {
+				return l.Add(-r), nil
+			}
+			return l.Add(r), nil
+		}
+	case time.Duration:
+		switch r := rv.(type) {
+		case time.Time:
+			return r.Add(l), nil
+		case time.Duration:
+			d, err := op.int(int64(l), int64(r))
+			return time.Duration(d), err
+		}
+		return scaleDuration(l, rv, op)
+	}
+	return scaleDuration(rv.(time.Duration), lv, op)
+}
+
+// 时长 * 数字 / 时长 / 数字
+func scaleDuration(d time.Duration, n any, op arithmetic) (any, error) {
+	v, err := toNumber(n, false)
+	if err != nil {
+		return nil, err
+	}
+	if i, ok := v.(int64); ok {
+		result, err := op.int(int64(d), i)
+		return time.Duration(result), err
+	}
+	result, err := op.float(float64(d), v.(float64))
+	if err != nil {
+		return nil, err
+	}
+	if math.IsNaN(result) || result >= math.MaxInt64 || result < math.MinInt64 {
+		return nil, fmt.Errorf("%w: %v %s %v", ErrOverflow, d, op.symbol, n)
+	}
+	return time.Duration(result), nil
+}
+
+// 比较两个时间或两个时长，返回 -1 / 0 / 1
+func compareTemporal(lv, rv any) (int, error) {
+	switch l := lv.(type) {
+	case time.Time:
+		if r, ok := rv.(time.Time); ok {
+			return l.Compare(r), nil
+		}
+	case time.Duration:
+		if r, ok := rv.(time.Duration); ok {
+			return cmp.Compare(l, r), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: cannot compare %s \"%v\" with %s \"%v\"", ErrTypeMismatch, typeName(syntax.InferType(lv)), lv, typeName(syntax.InferType(rv)), rv)
+}
@@ -1,11 +1,48 @@
 package syntax
 
-import "github.com/einsitang/go-security/internal/expr/ctx"
+import (
+	"math/big"
+	"reflect"
+	"time"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
+)
 
 const (
 	Type_Bool = 1 << iota
 	Type_Number
 	Type_String
+	Type_Null
+	Type_List
+	// time.Time
+	Type_Time
+	// time.Duration
+	Type_Duration
+)
+
+// 操作符优先级，数值越大结合越紧密，双元操作符均为左结合
+//
+//	or                  1
+//	and                 2
+//	! (前缀)            3
+//	== != in not in     4
+//	< <= > >=           5
+//	??                  6
+//	+ -                 7
+//	* / %               8
+//
+// ! 低于比较运算符: !$a == 1 => !($a == 1) ; 高于 and / or: !Role('a') and Role('b') => (!Role('a')) and Role('b')
+//
+// ?? 高于比较运算符: $a ?? 0 > 1 => ($a ?? 0) > 1 ; 低于数学运算符: $a ?? 1 + 1 => $a ?? (1 + 1)
+const (
+	PrecedenceOr = iota + 1
+	PrecedenceAnd
+	PrecedenceNegate
+	PrecedenceEquality
+	PrecedenceRelational
+	PrecedenceCoalesce
+	PrecedenceAdditive
+	PrecedenceMultiplicative
 )
 
 type SyntaxValue struct {
@@ -21,7 +58,7 @@ type SyntaxValue struct {
 
 type Syntax interface {
 
-	// 语句优先级
+	// 语句优先级，见 Precedence 常量
 	Priority() int
 
 	// 操作符支持参数个数 一元操作符为1，二元操作符为2
@@ -49,16 +86,70 @@ type Syntax interface {
 	Evaluate(c *ctx.Context) SyntaxValue
 }
 
+// 常量语句, 解析时即可取值
+type Constant interface {
+	Constant() any
+}
+
+// 可能不存在的值(如参数)，值不存在时 found 为 false ，不会返回错误
+type Optional interface {
+	Lookup(c *ctx.Context) (v any, found bool)
+}
+
+// 多参数语句(如函数调用), 参数不通过 Left / Right 访问
+type Operands interface {
+	Operands() []Syntax
+}
+
 // 推断值类型
 func InferType(val any) int {
 	t := Type_String
 	switch val.(type) {
 	case string:
 		t = Type_String
-	case int, int64, float32, float64:
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, *big.Rat:
 		t = Type_Number
 	case bool:
 		t = Type_Bool
+	case time.Time:
+		t = Type_Time
+	case time.Duration:
+		t = Type_Duration
+	case *List, []any, []string:
+		t = Type_List
+	default:
+		if _, ok := ListItems(val); ok {
+			t = Type_List
+		}
 	}
 	return t
 }
+
+// 列表元素
+//
+// 支持列表常量、slice 和 array (如重复的查询参数 ?tag=a&tag=b)，其他值返回 false
+func ListItems(val any) ([]any, bool) {
+	switch v := val.(type) {
+	case *List:
+		return v.Items(), true
+	case []any:
+		return v, true
+	case []string:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = item
+		}
+		return items, true
+	case []byte, nil:
+		return nil, false
+	}
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	items := make([]any, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+	return items, true
+}
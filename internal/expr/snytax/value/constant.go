@@ -1,6 +1,8 @@
 package value
 
 import (
+	"github.com/spf13/cast"
+
 	"github.com/einsitang/go-security/internal/expr/ctx"
 	syntax "github.com/einsitang/go-security/internal/expr/snytax"
 )
@@ -24,6 +26,9 @@ func (s *constantSyntax) InputType() int {
 }
 
 func (s *constantSyntax) ReturnType() int {
+	if s.val == nil {
+		return syntax.Type_Null
+	}
 	return syntax.InferType(s.val)
 }
 
@@ -45,14 +50,18 @@ func (s *constantSyntax) ChangeRight(right syntax.Syntax) {
 
 // 运行求值
 func (s *constantSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
-	t := syntax.InferType(s.val)
 	return syntax.SyntaxValue{
-		Type:    t,
+		Type:    s.ReturnType(),
 		Value:   s.val,
 		IsError: false,
 	}
 }
 
+// 常量值
+func (s *constantSyntax) Constant() any {
+	return s.val
+}
+
 func NewConstantSyntax(val any) syntax.Syntax {
 	switch val := val.(type) {
 	case string:
@@ -63,13 +72,13 @@ func NewConstantSyntax(val any) syntax.Syntax {
 		}
 	case int, int32, int64:
 		return &constantSyntax{
-			val:      int(val.(int64)),
+			val:      cast.ToInt64(val),
 			priority: 100,
 			kind:     0,
 		}
 	case float64, float32:
 		return &constantSyntax{
-			val:      val.(float32),
+			val:      cast.ToFloat64(val),
 			priority: 100,
 			kind:     0,
 		}
@@ -79,6 +88,13 @@ func NewConstantSyntax(val any) syntax.Syntax {
 			priority: 100,
 			kind:     0,
 		}
+	case nil:
+		// null
+		return &constantSyntax{
+			val:      nil,
+			priority: 100,
+			kind:     0,
+		}
 	}
 	panic("unknow value type")
 }
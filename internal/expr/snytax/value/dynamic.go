@@ -0,0 +1,204 @@
+package value
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+)
+
+// 参数在运行时求值的内置函数，如 Group($teamId) / Permission('orders.' + $tenant + '.read')
+//
+// 每次求值时先计算参数，再通过 build 创建参数为常量的内置函数语句并求值
+type dynamicSyntax struct {
+	name  string
+	args  []syntax.Syntax
+	build func(vals []string) (syntax.Syntax, error)
+	// 运行时取值的部分不能包含的字符
+	reserved string
+	priority int
+	kind     int
+}
+
+// 语句优先级
+func (s *dynamicSyntax) Priority() int {
+	return s.priority
+}
+
+// 操作符支持参数个数 一元操作符为1，二元操作符为2
+func (s *dynamicSyntax) Kind() int {
+	return s.kind
+}
+
+// 入参类型要求
+func (s *dynamicSyntax) InputType() int {
+	return syntax.Type_String
+}
+
+// 支持的出参类型,具体结果得执行 Evaluate 运行后得出
+func (s *dynamicSyntax) ReturnType() int {
+	return syntax.Type_Bool
+}
+
+func (s *dynamicSyntax) Left() syntax.Syntax {
+	panic("Syntax not support left value")
+}
+
+func (s *dynamicSyntax) Right() syntax.Syntax {
+	panic("Syntax not support right value")
+}
+
+func (s *dynamicSyntax) ChangeLeft(left syntax.Syntax) {
+	panic("Syntax not support left value")
+}
+
+func (s *dynamicSyntax) ChangeRight(right syntax.Syntax) {
+	panic("Syntax not support right value")
+}
+
+// 参数
+func (s *dynamicSyntax) Operands() []syntax.Syntax {
+	return s.args
+}
+
+// 运行求值
+func (s *dynamicSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
+	target, err := s.target(c)
+	if err != nil {
+		return syntax.SyntaxValue{
+			IsError: true,
+			Error:   err,
+		}
+	}
+	return target.Evaluate(c)
+}
+
+// 计算参数并创建内置函数语句
+func (s *dynamicSyntax) target(c *ctx.Context) (syntax.Syntax, error) {
+	vals := make([]string, len(s.args))
+	for i, arg := range s.args {
+		v := arg.Evaluate(c)
+		if v.IsError {
+			return nil, v.Error
+		}
+		switch v.Value.(type) {
+		case nil:
+			return nil, fmt.Errorf("%s: argument %d expect string, but got null", s.name, i+1)
+		case bool:
+			return nil, fmt.Errorf("%s: argument %d expect string, but got \"%v\"", s.name, i+1, v.Value)
+		}
+		val, err := cast.ToStringE(v.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: argument %d: %w", s.name, i+1, err)
+		}
+		if err := s.checkReserved(i, arg, c); err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+
+	target, err := s.build(vals)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.name, err)
+	}
+	return target, nil
+}
+
+// 检查参数中运行时取值的部分($ / # 参数、principal 属性等) 是否包含保留字符
+//
+// 如通配符权限 Permission('docs:' + $docId) 中 $docId 为 '123:read' 时会变成另一个权限，常量部分不受限制
+func (s *dynamicSyntax) checkReserved(i int, node syntax.Syntax, c *ctx.Context) error {
+	if s.reserved == "" {
+		return nil
+	}
+	if _, ok := node.(syntax.Constant); ok {
+		return nil
+	}
+
+	var children []syntax.Syntax
+	if operands, ok := node.(syntax.Operands); ok {
+		children = operands.Operands()
+	} else if node.Kind() == 1 {
+		children = []syntax.Syntax{node.Left()}
+	} else if node.Kind() == 2 {
+		children = []syntax.Syntax{node.Left(), node.Right()}
+	}
+	for _, child := range children {
+		if err := s.checkReserved(i, child, c); err != nil {
+			return err
+		}
+	}
+	if len(children) > 0 {
+		return nil
+	}
+
+	v := node.Evaluate(c)
+	if v.IsError {
+		return v.Error
+	}
+	if v.Value == nil {
+		return nil
+	}
+	if val := cast.ToString(v.Value); strings.ContainsAny(val, s.reserved) {
+		return fmt.Errorf("%s: argument %d contains \"%s\", dynamic values must not contain any of \"%s\"", s.name, i+1, val, s.reserved)
+	}
+	return nil
+}
+
+// 创建内置函数语句
+//
+// args 全部为字符串常量时在解析时直接调用 build , 否则在每次求值时调用；
+// multi 为 true 时 build 返回的语句需要实现 MultiValue ；
+// reserved 为运行时取值的部分不能包含的字符(如通配符权限的 ":,*")，为空时不检查
+func NewBuiltinSyntax(name string, args []syntax.Syntax, multi bool, reserved string, build func(vals []string) (syntax.Syntax, error)) (syntax.Syntax, error) {
+	vals := make([]string, len(args))
+	dynamic := false
+	for i, arg := range args {
+		if arg.ReturnType()&syntax.Type_String == 0 {
+			return nil, fmt.Errorf("mismatched types, %s argument %d expect string", name, i+1)
+		}
+		if constant, ok := arg.(syntax.Constant); ok {
+			if val, ok := constant.Constant().(string); ok {
+				vals[i] = val
+				continue
+			}
+		}
+		dynamic = true
+	}
+
+	if !dynamic {
+		return build(vals)
+	}
+	s := &dynamicSyntax{
+		name:     name,
+		args:     args,
+		build:    build,
+		reserved: reserved,
+		kind:     0,
+		priority: 100,
+	}
+	if multi {
+		return &dynamicMultiSyntax{s}, nil
+	}
+	return s, nil
+}
+
+// 多值内置函数，实现 MultiValue 以支持 AtLeast
+type dynamicMultiSyntax struct {
+	*dynamicSyntax
+}
+
+func (s *dynamicMultiSyntax) Count(c *ctx.Context) (int, error) {
+	target, err := s.target(c)
+	if err != nil {
+		return 0, err
+	}
+	return target.(MultiValue).Count(c)
+}
+
+func (s *dynamicMultiSyntax) Len() int {
+	return len(s.args)
+}
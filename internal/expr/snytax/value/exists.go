@@ -0,0 +1,76 @@
+package value
+
+import (
+	"errors"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+)
+
+// exists($x) / has(#x) 参数是否存在
+//
+// 参数存在但值为 null 时仍然成立；带访问路径时路径可以解析才成立，如 exists($order.customer.id)
+type existsSyntax struct {
+	param    *paramSyntax
+	priority int
+	kind     int
+}
+
+func (s *existsSyntax) Priority() int {
+	return s.priority
+}
+
+func (s *existsSyntax) Kind() int {
+	return s.kind
+}
+
+func (s *existsSyntax) InputType() int {
+	return syntax.Type_String | syntax.Type_Number | syntax.Type_Bool | syntax.Type_Null
+}
+
+func (s *existsSyntax) ReturnType() int {
+	return syntax.Type_Bool
+}
+
+func (s *existsSyntax) Left() syntax.Syntax {
+	panic("Syntax not support left value")
+}
+
+func (s *existsSyntax) Right() syntax.Syntax {
+	panic("Syntax not support right value")
+}
+
+func (s *existsSyntax) ChangeLeft(left syntax.Syntax) {
+	panic("Syntax not support left value")
+}
+
+func (s *existsSyntax) ChangeRight(right syntax.Syntax) {
+	panic("Syntax not support right value")
+}
+
+// 函数参数
+func (s *existsSyntax) Operands() []syntax.Syntax {
+	return []syntax.Syntax{s.param}
+}
+
+// 运行求值，不会因为参数不存在返回错误
+func (s *existsSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
+	_, found := s.param.Lookup(c)
+	return syntax.SyntaxValue{
+		Type:  syntax.Type_Bool,
+		Value: found,
+	}
+}
+
+// arg 必须是 $ / # 参数
+func NewExistsSyntax(arg syntax.Syntax) (syntax.Syntax, error) {
+	param, ok := arg.(*paramSyntax)
+	if !ok {
+		return nil, errors.New("argument must be a parameter")
+	}
+	return &existsSyntax{
+		param:    param,
+		priority: 100,
+		kind:     0,
+	}, nil
+}
@@ -74,7 +74,9 @@ func NewGroupSyntax(val string) syntax.Syntax {
 
 // Groups
 type groupsSyntax struct {
-	val      []string
+	val []string
+	// 全部满足(AllGroups)，否则任意一个满足
+	all      bool
 	priority int
 	kind     int
 }
@@ -123,20 +125,29 @@ func (s *groupsSyntax) ChangeRight(right syntax.Syntax) {
 
 // 运行求值
 func (s *groupsSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
-	v := false
-	for _, g := range c.Principal.Groups() {
-		if slices.Contains(s.val, g) {
-			v = true
-			break
-		}
-	}
 	return syntax.SyntaxValue{
 		Type:    syntax.Type_Bool,
-		Value:   v,
+		Value:   matchMulti(len(s.val), s.all, s.matcher(c)),
 		IsError: false,
 	}
 }
 
+func (s *groupsSyntax) Count(c *ctx.Context) (int, error) {
+	return countMulti(len(s.val), s.matcher(c))
+}
+
+func (s *groupsSyntax) Len() int {
+	return len(s.val)
+}
+
+// 第 i 个组是否满足
+func (s *groupsSyntax) matcher(c *ctx.Context) func(i int) bool {
+	held := c.Principal.Groups()
+	return func(i int) bool {
+		return slices.Contains(held, s.val[i])
+	}
+}
+
 func NewGroupsSyntax(val []string) syntax.Syntax {
 	return &groupsSyntax{
 		val:      val,
@@ -144,3 +155,13 @@ func NewGroupsSyntax(val []string) syntax.Syntax {
 		priority: 100,
 	}
 }
+
+// AllGroups(...)
+func NewAllGroupsSyntax(val []string) syntax.Syntax {
+	return &groupsSyntax{
+		val:      val,
+		all:      true,
+		kind:     0,
+		priority: 100,
+	}
+}
@@ -0,0 +1,194 @@
+package value
+
+import (
+	"fmt"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+)
+
+// lambda 变量，如 any($tags, t -> t == 'a') 中的 t
+//
+// 可以带访问路径: any($orders, o -> o.status == 'open')
+type lambdaVarSyntax struct {
+	name     string
+	path     path
+	priority int
+	kind     int
+}
+
+func (s *lambdaVarSyntax) Priority() int {
+	return s.priority
+}
+
+func (s *lambdaVarSyntax) Kind() int {
+	return s.kind
+}
+
+func (s *lambdaVarSyntax) InputType() int {
+	return syntax.Type_String
+}
+
+// 列表元素可能是任意类型
+func (s *lambdaVarSyntax) ReturnType() int {
+	return syntax.Type_String | syntax.Type_Number | syntax.Type_Bool | syntax.Type_Null | syntax.Type_Time | syntax.Type_Duration
+}
+
+func (s *lambdaVarSyntax) Left() syntax.Syntax {
+	panic("Syntax not support left value")
+}
+
+func (s *lambdaVarSyntax) Right() syntax.Syntax {
+	panic("Syntax not support right value")
+}
+
+func (s *lambdaVarSyntax) ChangeLeft(left syntax.Syntax) {
+	panic("Syntax not support left value")
+}
+
+func (s *lambdaVarSyntax) ChangeRight(right syntax.Syntax) {
+	panic("Syntax not support right value")
+}
+
+// 运行求值
+func (s *lambdaVarSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
+	v, ok := c.Local(s.name)
+	if !ok {
+		return syntax.SyntaxValue{
+			IsError: true,
+			Error:   fmt.Errorf("variable \"%s\" is not bound", s.name),
+		}
+	}
+	if len(s.path) > 0 {
+		var err error
+		if v, err = s.path.resolve(s.name, v); err != nil {
+			return syntax.SyntaxValue{
+				IsError: true,
+				Error:   err,
+			}
+		}
+	}
+	return syntax.SyntaxValue{
+		Type:  syntax.InferType(v),
+		Value: v,
+	}
+}
+
+func NewLambdaVarSyntax(name string, path ...any) syntax.Syntax {
+	return &lambdaVarSyntax{
+		name:     name,
+		path:     path,
+		priority: 100,
+		kind:     0,
+	}
+}
+
+// any(list, x -> 条件) / all(list, x -> 条件)
+//
+// list 不是列表时按单个元素处理，不存在(null)时按空列表处理: any 为 false , all 为 true
+type quantifierSyntax struct {
+	name     string
+	all      bool
+	list     syntax.Syntax
+	variable string
+	body     syntax.Syntax
+	priority int
+	kind     int
+}
+
+func (s *quantifierSyntax) Priority() int {
+	return s.priority
+}
+
+func (s *quantifierSyntax) Kind() int {
+	return s.kind
+}
+
+func (s *quantifierSyntax) InputType() int {
+	return syntax.Type_String | syntax.Type_Number | syntax.Type_Bool | syntax.Type_Null | syntax.Type_List
+}
+
+func (s *quantifierSyntax) ReturnType() int {
+	return syntax.Type_Bool
+}
+
+func (s *quantifierSyntax) Left() syntax.Syntax {
+	panic("Syntax not support left value")
+}
+
+func (s *quantifierSyntax) Right() syntax.Syntax {
+	panic("Syntax not support right value")
+}
+
+func (s *quantifierSyntax) ChangeLeft(left syntax.Syntax) {
+	panic("Syntax not support left value")
+}
+
+func (s *quantifierSyntax) ChangeRight(right syntax.Syntax) {
+	panic("Syntax not support right value")
+}
+
+// 函数参数，lambda 只能在绑定变量后求值，不作为参数
+func (s *quantifierSyntax) Operands() []syntax.Syntax {
+	return []syntax.Syntax{s.list}
+}
+
+// 运行求值
+//
+// any 遇到成立的元素、all 遇到不成立的元素时直接返回，之后的元素不再求值；元素求值出错时返回错误
+func (s *quantifierSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
+	listR := s.list.Evaluate(c)
+	if listR.IsError {
+		return listR
+	}
+
+	items, ok := syntax.ListItems(listR.Value)
+	if !ok && listR.Value != nil {
+		items = []any{listR.Value}
+	}
+	for _, item := range items {
+		r := s.body.Evaluate(c.WithLocal(s.variable, item))
+		if r.IsError {
+			return syntax.SyntaxValue{
+				IsError: true,
+				Error:   fmt.Errorf("%s: %w", s.name, r.Error),
+			}
+		}
+		matched, ok := r.Value.(bool)
+		if !ok {
+			return syntax.SyntaxValue{
+				IsError: true,
+				Error:   fmt.Errorf("%s: expect bool, but got \"%v\"", s.name, r.Value),
+			}
+		}
+		if matched != s.all {
+			return syntax.SyntaxValue{
+				Type:  syntax.Type_Bool,
+				Value: matched,
+			}
+		}
+	}
+	return syntax.SyntaxValue{
+		Type:  syntax.Type_Bool,
+		Value: s.all,
+	}
+}
+
+// name 为 any 或 all ，body 中通过 variable 访问列表元素
+func NewQuantifierSyntax(name string, list syntax.Syntax, variable string, body syntax.Syntax) (syntax.Syntax, error) {
+	if name != "any" && name != "all" {
+		return nil, fmt.Errorf("unknown quantifier %s", name)
+	}
+	if body.ReturnType()&syntax.Type_Bool == 0 {
+		return nil, fmt.Errorf("%s expect a bool condition. example: %s($tags, t -> t == 'public')", name, name)
+	}
+	return &quantifierSyntax{
+		name:     name,
+		all:      name == "all",
+		list:     list,
+		variable: variable,
+		body:     body,
+		priority: 100,
+		kind:     0,
+	}, nil
+}
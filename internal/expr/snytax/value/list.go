@@ -0,0 +1,63 @@
+package value
+
+import (
+	"github.com/einsitang/go-security/internal/expr/ctx"
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+	"github.com/einsitang/go-security/internal/expr/snytax/oper"
+)
+
+// 列表常量 ['a', 'b', 3]
+type listSyntax struct {
+	val      *syntax.List
+	priority int
+	kind     int
+}
+
+func (s *listSyntax) Priority() int {
+	return s.priority
+}
+
+func (s *listSyntax) Kind() int {
+	return s.kind
+}
+
+func (s *listSyntax) InputType() int {
+	return syntax.Type_String | syntax.Type_Number | syntax.Type_Bool | syntax.Type_Null
+}
+
+func (s *listSyntax) ReturnType() int {
+	return syntax.Type_List
+}
+
+func (s *listSyntax) Left() syntax.Syntax {
+	panic("Syntax not support left value")
+}
+
+func (s *listSyntax) Right() syntax.Syntax {
+	panic("Syntax not support right value")
+}
+
+func (s *listSyntax) ChangeLeft(left syntax.Syntax) {
+	panic("Syntax not support left value")
+}
+
+func (s *listSyntax) ChangeRight(right syntax.Syntax) {
+	panic("Syntax not support right value")
+}
+
+// 运行求值
+func (s *listSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
+	return syntax.SyntaxValue{
+		Type:  syntax.Type_List,
+		Value: s.val,
+	}
+}
+
+// 列表元素只能是常量，解析时构建成员索引
+func NewListSyntax(items []any) syntax.Syntax {
+	return &listSyntax{
+		val:      syntax.NewList(items, oper.NewListIndex(items)),
+		priority: 100,
+		kind:     0,
+	}
+}
@@ -0,0 +1,144 @@
+package value
+
+import (
+	"fmt"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+)
+
+// 多值内置函数 Roles / Permissions / Groups 及 AllRoles / AllPermissions / AllGroups
+//
+// 可以统计满足的值个数，用于 AtLeast
+type MultiValue interface {
+	syntax.Syntax
+	// 满足的值个数
+	Count(c *ctx.Context) (int, error)
+	// 值个数
+	Len() int
+}
+
+// 任意一个(all 为 false) / 全部(all 为 true) 值满足，结果确定后提前结束
+func matchMulti(n int, all bool, match func(i int) bool) bool {
+	for i := 0; i < n; i++ {
+		if match(i) != all {
+			return !all
+		}
+	}
+	return all
+}
+
+// 满足的值个数
+func countMulti(n int, match func(i int) bool) (int, error) {
+	count := 0
+	for i := 0; i < n; i++ {
+		if match(i) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// AtLeast(n, Permissions(...))
+//
+// 满足的值个数不少于 n
+type atLeastSyntax struct {
+	n        syntax.Syntax
+	count    int
+	target   MultiValue
+	priority int
+	kind     int
+}
+
+// 语句优先级
+func (s *atLeastSyntax) Priority() int {
+	return s.priority
+}
+
+// 操作符支持参数个数 一元操作符为1，二元操作符为2
+func (s *atLeastSyntax) Kind() int {
+	return s.kind
+}
+
+// 入参类型要求
+func (s *atLeastSyntax) InputType() int {
+	return syntax.Type_Number | syntax.Type_Bool
+}
+
+// 支持的出参类型,具体结果得执行 Evaluate 运行后得出
+func (s *atLeastSyntax) ReturnType() int {
+	return syntax.Type_Bool
+}
+
+func (s *atLeastSyntax) Left() syntax.Syntax {
+	panic("Syntax not support left value")
+}
+
+func (s *atLeastSyntax) Right() syntax.Syntax {
+	panic("Syntax not support right value")
+}
+
+func (s *atLeastSyntax) ChangeLeft(left syntax.Syntax) {
+	panic("Syntax not support left value")
+}
+
+func (s *atLeastSyntax) ChangeRight(right syntax.Syntax) {
+	panic("Syntax not support right value")
+}
+
+// 参数
+func (s *atLeastSyntax) Operands() []syntax.Syntax {
+	return []syntax.Syntax{s.n, s.target}
+}
+
+// 运行求值
+func (s *atLeastSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
+	count, err := s.target.Count(c)
+	if err != nil {
+		return syntax.SyntaxValue{
+			IsError: true,
+			Error:   err,
+		}
+	}
+	return syntax.SyntaxValue{
+		Type:    syntax.Type_Bool,
+		Value:   count >= s.count,
+		IsError: false,
+	}
+}
+
+// n 必须是正整数常量且不大于值个数，target 必须是多值内置函数
+func NewAtLeastSyntax(n syntax.Syntax, target syntax.Syntax) (syntax.Syntax, error) {
+	count, ok := integerConstant(n)
+	if !ok || count <= 0 {
+		return nil, fmt.Errorf("AtLeast expect a positive integer constant as argument 1")
+	}
+	multi, ok := target.(MultiValue)
+	if !ok {
+		return nil, fmt.Errorf("AtLeast expect Roles / Permissions / Groups as argument 2")
+	}
+	if count > multi.Len() {
+		return nil, fmt.Errorf("AtLeast(%d) can never be satisfied, only %d values are given", count, multi.Len())
+	}
+	return &atLeastSyntax{
+		n:        n,
+		count:    count,
+		target:   multi,
+		kind:     0,
+		priority: 100,
+	}, nil
+}
+
+func integerConstant(s syntax.Syntax) (int, bool) {
+	constant, ok := s.(syntax.Constant)
+	if !ok {
+		return 0, false
+	}
+	switch n := constant.Constant().(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	}
+	return 0, false
+}
@@ -1,16 +1,36 @@
 package value
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/einsitang/go-security/internal/expr/ctx"
 	syntax "github.com/einsitang/go-security/internal/expr/snytax"
 )
 
+// 参数不存在
+var ErrMissingParam = errors.New("missing parameter")
+
+// 参数不存在时返回 ErrMissingParam ，由解析器在创建参数语句时设置
+type Required interface {
+	SetRequired()
+}
+
 type paramSyntax struct {
 	// 占位符 or 自定义参数
 	isPlaceholder bool
 	val           string
-	priority      int
-	kind          int
+	// 访问路径，如 $order.customer.id 中的 customer.id
+	path     path
+	priority int
+	kind     int
+	// 参数不存在时返回错误，而不是 null
+	required bool
+}
+
+// 参数不存在时返回 ErrMissingParam
+func (s *paramSyntax) SetRequired() {
+	s.required = true
 }
 
 // 语句优先级
@@ -28,8 +48,10 @@ func (s *paramSyntax) InputType() int {
 }
 
 // 出参类型
+//
+// 参数值由调用方传入，可能是任意类型，也可能不存在(null)
 func (s *paramSyntax) ReturnType() int {
-	return syntax.Type_String | syntax.Type_Number
+	return syntax.Type_String | syntax.Type_Number | syntax.Type_Bool | syntax.Type_Null | syntax.Type_Time | syntax.Type_Duration
 }
 
 // Left,Right 左右值入参
@@ -51,12 +73,18 @@ func (s *paramSyntax) ChangeRight(right syntax.Syntax) {
 
 // 运行求值
 func (s *paramSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
-
-	var v any
-	if s.isPlaceholder {
-		v = c.Params[s.val]
-	} else {
-		v = c.CustomParams[s.val]
+	v, found, err := s.resolve(c)
+	if err != nil {
+		return syntax.SyntaxValue{
+			IsError: true,
+			Error:   err,
+		}
+	}
+	if !found && s.required {
+		return syntax.SyntaxValue{
+			IsError: true,
+			Error:   fmt.Errorf("%w: %s", ErrMissingParam, s.root()),
+		}
 	}
 
 	return syntax.SyntaxValue{
@@ -66,10 +94,50 @@ func (s *paramSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
 	}
 }
 
-func NewParamSyntax(val string, isPlaceholder bool) syntax.Syntax {
+// 取值，参数不存在或访问路径无法解析时 found 为 false
+func (s *paramSyntax) Lookup(c *ctx.Context) (v any, found bool) {
+	v, found, _ = s.resolve(c)
+	return v, found
+}
+
+// 参数不存在时 found 为 false ；访问路径无法解析(包括参数不存在)时返回 MissingPathError
+func (s *paramSyntax) resolve(c *ctx.Context) (v any, found bool, err error) {
+	if s.isPlaceholder {
+		v, found = c.Params[s.val]
+		if !found && isIndex(s.val) {
+			// 兼容旧的通配符参数名 $0 / $1 ...
+			v, found = c.Params["$"+s.val]
+		}
+	} else {
+		v, found = c.Custom(s.val)
+	}
+	if len(s.path) == 0 {
+		return v, found, nil
+	}
+	if v, err = s.path.resolve(s.root(), v); err != nil {
+		return nil, false, err
+	}
+	return v, true, nil
+}
+
+func (s *paramSyntax) root() string {
+	if s.isPlaceholder {
+		return "$" + s.val
+	}
+	return "#" + s.val
+}
+
+// 参数名，如 $path.userId 返回 path.userId ; isPlaceholder 为 false 表示 # 参数
+func (s *paramSyntax) Param() (name string, isPlaceholder bool) {
+	return s.val, s.isPlaceholder
+}
+
+// path 为访问路径，元素为 string (字段名/键名) 或 int (下标)
+func NewParamSyntax(val string, isPlaceholder bool, path ...any) syntax.Syntax {
 	return &paramSyntax{
 		isPlaceholder: isPlaceholder,
 		val:           val,
+		path:          path,
 		kind:          0,
 		priority:      100,
 	}
@@ -0,0 +1,199 @@
+package value
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 访问路径无法解析
+//
+// 如 #order.customer.id 中 order 没有 customer 字段，或 #items[3] 越界
+type MissingPathError struct {
+	// 完整路径，如 #order.customer.id
+	Path string
+	// 无法解析的部分，如 customer / [3]
+	Segment string
+	// 原因
+	Reason string
+}
+
+func (e *MissingPathError) Error() string {
+	return fmt.Sprintf("cannot resolve %s of %s: %s", e.Segment, e.Path, e.Reason)
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// 访问路径
+//
+// 元素为 string 时表示字段名/键名 (.name / ['name'])，为 int 时表示下标 ([0])
+type path []any
+
+func (p path) String() string {
+	var b strings.Builder
+	for _, seg := range p {
+		b.WriteString(segmentString(seg))
+	}
+	return b.String()
+}
+
+func segmentString(seg any) string {
+	switch seg := seg.(type) {
+	case int:
+		return "[" + strconv.Itoa(seg) + "]"
+	case string:
+		if identifierPattern.MatchString(seg) || isIndex(seg) {
+			return "." + seg
+		}
+		return "['" + seg + "']"
+	}
+	return ""
+}
+
+func isIndex(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// 沿路径取值，支持 map / slice / array / 结构体导出字段(字段名、json tag 或忽略大小写的字段名)
+//
+// root 为路径起点的名称，仅用于错误信息
+func (p path) resolve(root string, v any) (any, error) {
+	for i, seg := range p {
+		fail := func(reason string) error {
+			return &MissingPathError{Path: root + p.String(), Segment: strings.TrimPrefix(segmentString(seg), "."), Reason: reason}
+		}
+
+		rv := reflect.ValueOf(v)
+		for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+			rv = rv.Elem()
+		}
+		if !rv.IsValid() {
+			return nil, fail(fmt.Sprintf("%s is null", root+p[:i].String()))
+		}
+
+		var next reflect.Value
+		switch rv.Kind() {
+		case reflect.Map:
+			key, ok := mapKey(rv.Type().Key(), seg)
+			if !ok {
+				return nil, fail("invalid key type")
+			}
+			next = rv.MapIndex(key)
+			if !next.IsValid() {
+				return nil, fail("key not found")
+			}
+		case reflect.Slice, reflect.Array:
+			index, ok := seg.(int)
+			if !ok {
+				// .0 也可以作为下标
+				var err error
+				if index, err = strconv.Atoi(seg.(string)); err != nil {
+					return nil, fail("expect index")
+				}
+			}
+			if index < 0 || index >= rv.Len() {
+				return nil, fail("index out of range")
+			}
+			next = rv.Index(index)
+		case reflect.Struct:
+			name, ok := seg.(string)
+			if !ok {
+				return nil, fail("expect field name")
+			}
+			next = structField(rv, name)
+			if !next.IsValid() {
+				return nil, fail("field not found")
+			}
+		default:
+			return nil, fail(fmt.Sprintf("%s is not a map, slice or struct", root+p[:i].String()))
+		}
+		v = next.Interface()
+	}
+	return normalize(v), nil
+}
+
+func mapKey(keyType reflect.Type, seg any) (reflect.Value, bool) {
+	switch keyType.Kind() {
+	case reflect.String:
+		var s string
+		switch seg := seg.(type) {
+		case string:
+			s = seg
+		case int:
+			s = strconv.Itoa(seg)
+		}
+		return reflect.ValueOf(s).Convert(keyType), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int
+		switch seg := seg.(type) {
+		case int:
+			i = seg
+		case string:
+			var err error
+			if i, err = strconv.Atoi(seg); err != nil {
+				return reflect.Value{}, false
+			}
+		}
+		return reflect.ValueOf(int64(i)).Convert(keyType), true
+	case reflect.Interface:
+		return reflect.ValueOf(seg), true
+	}
+	return reflect.Value{}, false
+}
+
+// 查找结构体导出字段: 字段名 > json tag > 忽略大小写的字段名
+func structField(rv reflect.Value, name string) reflect.Value {
+	t := rv.Type()
+	if f, ok := t.FieldByName(name); ok && f.IsExported() {
+		return rv.FieldByIndex(f.Index)
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if tag == name {
+			return rv.Field(i)
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.IsExported() && strings.EqualFold(f.Name, name) {
+			return rv.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// 将自定义类型(如 type Status string)及各种整数类型转换为表达式能识别的基础类型
+func normalize(v any) any {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+		v = rv.Interface()
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u)
+		}
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return v
+}
@@ -9,7 +9,9 @@ import (
 
 // Permission("...")
 type permissionSyntax struct {
-	val      string
+	val string
+	// 非 nil 时按通配符权限匹配
+	wildcard *WildcardPermission
 	priority int
 	kind     int
 }
@@ -57,9 +59,15 @@ func (s *permissionSyntax) ChangeRight(right syntax.Syntax) {
 
 // 运行求值
 func (s *permissionSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
+	var v bool
+	if s.wildcard != nil {
+		v = impliesAny(c.Principal.Permissions(), s.wildcard)
+	} else {
+		v = slices.Contains(c.Principal.Permissions(), s.val)
+	}
 	return syntax.SyntaxValue{
 		Type:    syntax.Type_Bool,
-		Value:   slices.Contains(c.Principal.Permissions(), s.val),
+		Value:   v,
 		IsError: false,
 	}
 }
@@ -72,9 +80,27 @@ func NewPermissionSyntax(val string) syntax.Syntax {
 	}
 }
 
+// 通配符权限匹配的 Permission("...") , val 无法解析时返回错误
+func NewWildcardPermissionSyntax(val string) (syntax.Syntax, error) {
+	wildcard, err := ParseWildcardPermission(val)
+	if err != nil {
+		return nil, err
+	}
+	return &permissionSyntax{
+		val:      val,
+		wildcard: wildcard,
+		kind:     0,
+		priority: 100,
+	}, nil
+}
+
 // Permissions
 type permissionsSyntax struct {
-	val      []string
+	val []string
+	// 非 nil 时按通配符权限匹配
+	wildcards []*WildcardPermission
+	// 全部满足(AllPermissions)，否则任意一个满足
+	all      bool
 	priority int
 	kind     int
 }
@@ -123,20 +149,34 @@ func (s *permissionsSyntax) ChangeRight(right syntax.Syntax) {
 
 // 运行求值
 func (s *permissionsSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
-	v := false
-	for _, g := range c.Principal.Permissions() {
-		if slices.Contains(s.val, g) {
-			v = true
-			break
-		}
-	}
 	return syntax.SyntaxValue{
 		Type:    syntax.Type_Bool,
-		Value:   v,
+		Value:   matchMulti(len(s.val), s.all, s.matcher(c)),
 		IsError: false,
 	}
 }
 
+func (s *permissionsSyntax) Count(c *ctx.Context) (int, error) {
+	return countMulti(len(s.val), s.matcher(c))
+}
+
+func (s *permissionsSyntax) Len() int {
+	return len(s.val)
+}
+
+// 第 i 个权限是否满足
+func (s *permissionsSyntax) matcher(c *ctx.Context) func(i int) bool {
+	held := c.Principal.Permissions()
+	if s.wildcards != nil {
+		return func(i int) bool {
+			return impliesAny(held, s.wildcards[i])
+		}
+	}
+	return func(i int) bool {
+		return slices.Contains(held, s.val[i])
+	}
+}
+
 func NewPermissionsSyntax(val []string) syntax.Syntax {
 	return &permissionsSyntax{
 		val:      val,
@@ -144,3 +184,39 @@ func NewPermissionsSyntax(val []string) syntax.Syntax {
 		priority: 100,
 	}
 }
+
+// 通配符权限匹配的 Permissions(...) , 任意一个值无法解析时返回错误
+func NewWildcardPermissionsSyntax(val []string) (syntax.Syntax, error) {
+	wildcards := make([]*WildcardPermission, len(val))
+	for i, v := range val {
+		wildcard, err := ParseWildcardPermission(v)
+		if err != nil {
+			return nil, err
+		}
+		wildcards[i] = wildcard
+	}
+	return &permissionsSyntax{
+		val:       val,
+		wildcards: wildcards,
+		kind:      0,
+		priority:  100,
+	}, nil
+}
+
+// AllPermissions(...) , wildcard 为 true 时按通配符权限匹配，任意一个值无法解析时返回错误
+func NewAllPermissionsSyntax(val []string, wildcard bool) (syntax.Syntax, error) {
+	if !wildcard {
+		return &permissionsSyntax{
+			val:      val,
+			all:      true,
+			kind:     0,
+			priority: 100,
+		}, nil
+	}
+	s, err := NewWildcardPermissionsSyntax(val)
+	if err != nil {
+		return nil, err
+	}
+	s.(*permissionsSyntax).all = true
+	return s, nil
+}
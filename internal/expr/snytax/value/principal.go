@@ -0,0 +1,102 @@
+package value
+
+import (
+	"errors"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+)
+
+// principal 的 id 属性, 总是取 Principal.Id()
+const PrincipalId = "id"
+
+// principal.name
+//
+// principal.id 为 Principal.Id() , 其他属性从 AttributedPrincipal.Attributes() 中获取，不存在时为 null
+type principalSyntax struct {
+	attr string
+	// 访问路径，如 principal.address.city 中的 city
+	path     path
+	priority int
+	kind     int
+}
+
+// 语句优先级
+func (s *principalSyntax) Priority() int {
+	return s.priority
+}
+
+// 入参个数
+func (s *principalSyntax) Kind() int {
+	return s.kind
+}
+
+func (s *principalSyntax) InputType() int {
+	return syntax.Type_String
+}
+
+// 出参类型
+func (s *principalSyntax) ReturnType() int {
+	if s.attr == PrincipalId && len(s.path) == 0 {
+		return syntax.Type_String
+	}
+	return syntax.Type_String | syntax.Type_Number | syntax.Type_Bool | syntax.Type_Null | syntax.Type_Time | syntax.Type_Duration
+}
+
+func (s *principalSyntax) Left() syntax.Syntax {
+	panic("Syntax not support left value")
+}
+
+func (s *principalSyntax) Right() syntax.Syntax {
+	panic("Syntax not support right value")
+}
+
+func (s *principalSyntax) ChangeLeft(left syntax.Syntax) {
+	panic("Syntax not support left value")
+}
+
+func (s *principalSyntax) ChangeRight(right syntax.Syntax) {
+	panic("Syntax not support right value")
+}
+
+// 运行求值
+func (s *principalSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
+	if c.Principal == nil {
+		return syntax.SyntaxValue{
+			IsError: true,
+			Error:   errors.New("principal is nil"),
+		}
+	}
+
+	var v any
+	if s.attr == PrincipalId {
+		v = c.Principal.Id()
+	} else if attributed, ok := c.Principal.(ctx.AttributedPrincipal); ok {
+		v = attributed.Attributes()[s.attr]
+	}
+
+	if len(s.path) > 0 {
+		var err error
+		if v, err = s.path.resolve("principal."+s.attr, v); err != nil {
+			return syntax.SyntaxValue{
+				IsError: true,
+				Error:   err,
+			}
+		}
+	}
+
+	return syntax.SyntaxValue{
+		Type:  syntax.InferType(v),
+		Value: v,
+	}
+}
+
+// path 为访问路径，元素为 string (字段名/键名) 或 int (下标)
+func NewPrincipalSyntax(attr string, path ...any) syntax.Syntax {
+	return &principalSyntax{
+		attr:     attr,
+		path:     path,
+		kind:     0,
+		priority: 100,
+	}
+}
@@ -9,9 +9,11 @@ import (
 
 // Role("...")
 type roleSyntax struct {
-	val      string
-	priority int
-	kind     int
+	val string
+	// 非 nil 时按角色继承匹配
+	hierarchy *RoleHierarchy
+	priority  int
+	kind      int
 }
 
 // 语句优先级
@@ -57,9 +59,15 @@ func (s *roleSyntax) ChangeRight(right syntax.Syntax) {
 
 // 运行求值
 func (s *roleSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
+	var v bool
+	if s.hierarchy != nil {
+		v = s.hierarchy.impliesAny(c.Principal.Roles(), s.val)
+	} else {
+		v = slices.Contains(c.Principal.Roles(), s.val)
+	}
 	return syntax.SyntaxValue{
 		Type:    syntax.Type_Bool,
-		Value:   slices.Contains(c.Principal.Roles(), s.val),
+		Value:   v,
 		IsError: false,
 	}
 }
@@ -72,9 +80,23 @@ func NewRoleSyntax(val string) syntax.Syntax {
 	}
 }
 
+// 按角色继承匹配的 Role("...")
+func NewHierarchyRoleSyntax(val string, hierarchy *RoleHierarchy) syntax.Syntax {
+	return &roleSyntax{
+		val:       val,
+		hierarchy: hierarchy,
+		kind:      0,
+		priority:  100,
+	}
+}
+
 // Roles
 type rolesSyntax struct {
-	val      []string
+	val []string
+	// 非 nil 时按角色继承匹配
+	hierarchy *RoleHierarchy
+	// 全部满足(AllRoles)，否则任意一个满足
+	all      bool
 	priority int
 	kind     int
 }
@@ -123,20 +145,34 @@ func (s *rolesSyntax) ChangeRight(right syntax.Syntax) {
 
 // 运行求值
 func (s *rolesSyntax) Evaluate(c *ctx.Context) syntax.SyntaxValue {
-	v := false
-	for _, g := range c.Principal.Roles() {
-		if slices.Contains(s.val, g) {
-			v = true
-			break
-		}
-	}
 	return syntax.SyntaxValue{
 		Type:    syntax.Type_Bool,
-		Value:   v,
+		Value:   matchMulti(len(s.val), s.all, s.matcher(c)),
 		IsError: false,
 	}
 }
 
+func (s *rolesSyntax) Count(c *ctx.Context) (int, error) {
+	return countMulti(len(s.val), s.matcher(c))
+}
+
+func (s *rolesSyntax) Len() int {
+	return len(s.val)
+}
+
+// 第 i 个角色是否满足
+func (s *rolesSyntax) matcher(c *ctx.Context) func(i int) bool {
+	held := c.Principal.Roles()
+	if s.hierarchy != nil {
+		return func(i int) bool {
+			return s.hierarchy.impliesAny(held, s.val[i])
+		}
+	}
+	return func(i int) bool {
+		return slices.Contains(held, s.val[i])
+	}
+}
+
 func NewRolesSyntax(val []string) syntax.Syntax {
 	return &rolesSyntax{
 		val:      val,
@@ -144,3 +180,24 @@ func NewRolesSyntax(val []string) syntax.Syntax {
 		priority: 100,
 	}
 }
+
+// 按角色继承匹配的 Roles(...)
+func NewHierarchyRolesSyntax(val []string, hierarchy *RoleHierarchy) syntax.Syntax {
+	return &rolesSyntax{
+		val:       val,
+		hierarchy: hierarchy,
+		kind:      0,
+		priority:  100,
+	}
+}
+
+// AllRoles(...) , hierarchy 非 nil 时按角色继承匹配
+func NewAllRolesSyntax(val []string, hierarchy *RoleHierarchy) syntax.Syntax {
+	return &rolesSyntax{
+		val:       val,
+		hierarchy: hierarchy,
+		all:       true,
+		kind:      0,
+		priority:  100,
+	}
+}
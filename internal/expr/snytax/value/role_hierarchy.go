@@ -0,0 +1,119 @@
+package value
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// 角色继承
+//
+// 高级角色蕴含低级角色，如 admin > manager > user 时 admin 同时拥有 manager 和 user 角色
+//
+// 创建时检查循环继承并预先计算传递闭包，检查时只需查表
+type RoleHierarchy struct {
+	// 角色 => 蕴含的全部角色(不含自身)
+	implies map[string]map[string]struct{}
+}
+
+// 根据 角色 => 直接蕴含的角色 创建角色继承
+func NewRoleHierarchy(inherits map[string][]string) (*RoleHierarchy, error) {
+	for role, lower := range inherits {
+		if strings.TrimSpace(role) == "" || slices.ContainsFunc(lower, func(r string) bool { return strings.TrimSpace(r) == "" }) {
+			return nil, fmt.Errorf("role hierarchy: empty role name")
+		}
+	}
+
+	h := &RoleHierarchy{implies: map[string]map[string]struct{}{}}
+
+	// 深度优先计算闭包，visiting 中的角色再次出现即为循环
+	visiting := map[string]bool{}
+	var visit func(role string, path []string) error
+	visit = func(role string, path []string) error {
+		if _, ok := h.implies[role]; ok {
+			return nil
+		}
+		if visiting[role] {
+			i := slices.Index(path, role)
+			return fmt.Errorf("role hierarchy: cycle detected %s", strings.Join(append(path[i:], role), " > "))
+		}
+		visiting[role] = true
+		path = append(path, role)
+
+		closure := map[string]struct{}{}
+		for _, lower := range inherits[role] {
+			if err := visit(lower, path); err != nil {
+				return err
+			}
+			closure[lower] = struct{}{}
+			for r := range h.implies[lower] {
+				closure[r] = struct{}{}
+			}
+		}
+		delete(closure, role)
+		visiting[role] = false
+		h.implies[role] = closure
+		return nil
+	}
+
+	// 按角色名顺序遍历，保证错误信息稳定
+	roles := make([]string, 0, len(inherits))
+	for role := range inherits {
+		roles = append(roles, role)
+	}
+	slices.Sort(roles)
+	for _, role := range roles {
+		if err := visit(role, nil); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// 解析文本格式的角色继承
+//
+// 每行一条继承链，如 admin > manager > user , # 开头的行为注释，空行忽略
+func ParseRoleHierarchy(text string) (*RoleHierarchy, error) {
+	inherits := map[string][]string{}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		chain := strings.Split(line, ">")
+		if len(chain) < 2 {
+			return nil, fmt.Errorf("role hierarchy: line %d: expect \"higher > lower\"", i+1)
+		}
+		for j := range chain {
+			chain[j] = strings.TrimSpace(chain[j])
+			if chain[j] == "" {
+				return nil, fmt.Errorf("role hierarchy: line %d: empty role name", i+1)
+			}
+		}
+		for j := 0; j < len(chain)-1; j++ {
+			if !slices.Contains(inherits[chain[j]], chain[j+1]) {
+				inherits[chain[j]] = append(inherits[chain[j]], chain[j+1])
+			}
+		}
+	}
+	return NewRoleHierarchy(inherits)
+}
+
+// 持有角色 held 是否蕴含角色 required
+func (h *RoleHierarchy) Implies(held string, required string) bool {
+	if held == required {
+		return true
+	}
+	_, ok := h.implies[held][required]
+	return ok
+}
+
+// 持有的角色中是否有蕴含 required 的角色
+func (h *RoleHierarchy) impliesAny(held []string, required string) bool {
+	for _, r := range held {
+		if h.Implies(r, required) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package value
+
+import (
+	"errors"
+	"strings"
+)
+
+// 通配符权限 (Shiro 风格)
+//
+// 格式为 domain:action:instance , 层级数不限，每一层可以是 * 或用 , 分隔的多个值，如 docs:read,write:*
+//
+// 持有的权限 a 蕴含(implies)要求的权限 b 的规则:
+//
+// - 逐层比较，a 的每一层为 * 或者包含 b 对应层的全部值
+//
+// - a 的层数比 b 少时，缺少的层视为 * , 如 orders 蕴含 orders:read:1
+//
+// - a 的层数比 b 多时，多出来的层必须为 * , 如 orders:read:* 蕴含 orders:read
+type WildcardPermission struct {
+	raw   string
+	parts []map[string]struct{}
+}
+
+const wildcardToken = "*"
+
+// 通配符权限的分隔符及通配符，动态参数(如 Permission('docs:' + $docId))的值不能包含这些字符
+const WildcardReserved = ":,*"
+
+func ParseWildcardPermission(permission string) (*WildcardPermission, error) {
+	permission = strings.TrimSpace(permission)
+	if permission == "" {
+		return nil, errors.New("permission is empty")
+	}
+	p := &WildcardPermission{raw: permission}
+	for _, part := range strings.Split(permission, ":") {
+		subparts := map[string]struct{}{}
+		for _, sub := range strings.Split(part, ",") {
+			sub = strings.TrimSpace(sub)
+			if sub == "" {
+				return nil, errors.New("invalid permission \"" + permission + "\", empty part")
+			}
+			subparts[sub] = struct{}{}
+		}
+		p.parts = append(p.parts, subparts)
+	}
+	return p, nil
+}
+
+// 是否蕴含 required
+func (p *WildcardPermission) Implies(required *WildcardPermission) bool {
+	for i, part := range required.parts {
+		if i >= len(p.parts) {
+			return true
+		}
+		if isWildcardPart(p.parts[i]) {
+			continue
+		}
+		for sub := range part {
+			if _, ok := p.parts[i][sub]; !ok {
+				return false
+			}
+		}
+	}
+	for _, part := range p.parts[min(len(required.parts), len(p.parts)):] {
+		if !isWildcardPart(part) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *WildcardPermission) String() string {
+	return p.raw
+}
+
+func isWildcardPart(part map[string]struct{}) bool {
+	_, ok := part[wildcardToken]
+	return ok
+}
+
+// 持有的权限中是否有蕴含 required 的权限，无法解析的持有权限会被忽略
+func impliesAny(held []string, required *WildcardPermission) bool {
+	for _, h := range held {
+		p, err := ParseWildcardPermission(h)
+		if err == nil && p.Implies(required) {
+			return true
+		}
+	}
+	return false
+}
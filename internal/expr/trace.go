@@ -0,0 +1,169 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
+	syntax "github.com/einsitang/go-security/internal/expr/snytax"
+	"github.com/einsitang/go-security/internal/expr/tokenizer"
+)
+
+// 节点在原始表达式中的位置 [Start, End)
+type Span struct {
+	Start int
+	End   int
+}
+
+// 解析时记录的节点信息
+type nodeInfo struct {
+	span Span
+	// 操作符 或 内置函数名, 常量/参数为空
+	operator string
+}
+
+// 节点求值轨迹
+type Trace struct {
+	// 节点在原始表达式中的位置
+	Span Span
+	// 节点对应的表达式片段
+	Text string
+	// 操作符 或 内置函数名, 常量/参数为空
+	Operator string
+	// 求值结果
+	Value any
+	// 求值错误
+	Error error
+	// 被短路跳过，未求值
+	Skipped bool
+	// 操作数的求值轨迹
+	Operands []*Trace
+}
+
+// Explain 求值并记录每个节点的结果
+//
+// 每个节点都会单独求值一次，仅用于调试，不要在检查流程中使用
+func (st *SyntaxTree) Explain(c *ctx.Context) *Trace {
+	if st.Syntax == nil {
+		return nil
+	}
+	return st.explain(st.Syntax, c)
+}
+
+func (st *SyntaxTree) explain(node syntax.Syntax, c *ctx.Context) *Trace {
+	info := st.nodes[node]
+	trace := &Trace{
+		Span:     info.span,
+		Text:     st.input[info.span.Start:info.span.End],
+		Operator: info.operator,
+	}
+
+	if operands, ok := node.(syntax.Operands); ok {
+		// 函数参数
+		for _, operand := range operands.Operands() {
+			trace.Operands = append(trace.Operands, st.explain(operand, c))
+		}
+	}
+
+	switch node.Kind() {
+	case 1:
+		trace.Operands = []*Trace{st.explain(node.Left(), c)}
+	case 2:
+		left := st.explain(node.Left(), c)
+		var right *Trace
+		if sc, ok := node.(shortCircuit); ok && left.Error == nil && sc.ShortCircuit(left.Value) {
+			right = st.skipped(node.Right())
+		} else {
+			right = st.explain(node.Right(), c)
+		}
+		trace.Operands = []*Trace{left, right}
+	}
+
+	eval := node.Evaluate(c)
+	if eval.IsError {
+		trace.Error = eval.Error
+	} else {
+		trace.Value = eval.Value
+	}
+	return trace
+}
+
+// 被短路跳过的节点
+func (st *SyntaxTree) skipped(node syntax.Syntax) *Trace {
+	info := st.nodes[node]
+	return &Trace{
+		Span:     info.span,
+		Text:     st.input[info.span.Start:info.span.End],
+		Operator: info.operator,
+		Skipped:  true,
+	}
+}
+
+// 支持短路求值的操作符 (and / or)
+type shortCircuit interface {
+	ShortCircuit(left any) bool
+}
+
+// Render 在原始表达式下方逐个标注节点的求值结果
+//
+//	allow: Role('admin') or $quota < 10
+//	       ^^^^^^^^^^^^^ Role => false
+//	                        ^^^^^^ 12
+//	                                 ^^ 10
+//	                        ^^^^^^^^^^^ < => true
+//	       ^^^^^^^^^^^^^^^^^^^^^^^^^^^^ or => true
+func (t *Trace) Render(input string) string {
+	var b strings.Builder
+	b.WriteString(strings.ReplaceAll(input, "\n", " "))
+	b.WriteString("\n")
+	t.render(&b, input)
+	return b.String()
+}
+
+func (t *Trace) render(b *strings.Builder, input string) {
+	if t == nil {
+		return
+	}
+	for _, operand := range t.Operands {
+		operand.render(b, input)
+	}
+
+	b.WriteString(strings.Repeat(" ", utf8.RuneCountInString(input[:t.Span.Start])))
+	b.WriteString(strings.Repeat("^", max(utf8.RuneCountInString(t.Text), 1)))
+	b.WriteString(" ")
+	if t.Operator != "" {
+		b.WriteString(t.Operator)
+		b.WriteString(" => ")
+	}
+	b.WriteString(t.FormatValue())
+	b.WriteString("\n")
+}
+
+// FormatValue 格式化求值结果
+func (t *Trace) FormatValue() string {
+	if t.Skipped {
+		return "skipped"
+	}
+	if t.Error != nil {
+		return "error: " + t.Error.Error()
+	}
+	switch v := t.Value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("%q", v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(t.Value)
+}
+
+// token 在原始表达式中的结束位置
+func tokenEnd(token *tokenizer.Token, input string) int {
+	if !token.IsValid() {
+		return len(input)
+	}
+	return token.Offset() + len(token.Value())
+}
@@ -54,7 +54,10 @@ func Match(fullPath, pattern string) (bool, map[string]string, error) {
 		params[k] = v
 	}
 	for k, v := range actualQueryParams {
-		params[k] = v
+		// 路径参数优先，查询参数不能覆盖同名路径参数
+		if _, exists := params[k]; !exists {
+			params[k] = v
+		}
 	}
 
 	return true, params, nil
@@ -100,8 +103,11 @@ func MatchPath(fullPath, pattern string) (bool, map[string]string, error) {
 	for k, v := range pathParams {
 		params[k] = v
 	}
-	for k, _ := range patternQueryParams {
-		params[k] = actualQueryParams[k]
+	for k := range patternQueryParams {
+		// 路径参数优先，查询参数不能覆盖同名路径参数
+		if _, exists := params[k]; !exists {
+			params[k] = actualQueryParams[k]
+		}
 	}
 	// 返回路径参数
 	return true, params, nil
@@ -3,8 +3,13 @@ package parse
 import (
 	"fmt"
 	"log"
+	"maps"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/einsitang/go-security/internal/expr/ctx"
 )
 
 type NotMatchRouterError error
@@ -13,6 +18,8 @@ type NotMatchRouterError error
 type Router struct {
 	// root *node // 根节点
 	roots map[string]*node // 根节点
+	// With 写时复制时已属于当前路由树、可以直接修改的节点
+	owned map[*node]bool
 }
 
 // node 路由树节点
@@ -53,6 +60,45 @@ func NewRouter(patterns []string) *Router {
 	return router
 }
 
+// With 返回添加了路由规则的新路由树，当前路由树保持不变
+//
+// 只复制插入路径上的节点，其余节点与当前路由树共享，添加一条规则不需要重建整个路由树
+func (r *Router) With(patterns ...string) *Router {
+	next := &Router{
+		roots: maps.Clone(r.roots),
+		owned: make(map[*node]bool),
+	}
+	next.Add(patterns...)
+	next.owned = nil
+	return next
+}
+
+// 写时复制: 节点不属于当前路由树时复制一份再修改
+func (r *Router) own(n *node) *node {
+	if r.owned == nil || r.owned[n] {
+		return n
+	}
+	c := *n
+	c.staticChildren = maps.Clone(n.staticChildren)
+	c.paramNames = slices.Clone(n.paramNames)
+	r.owned[&c] = true
+	return &c
+}
+
+// 新建节点
+func (r *Router) newNode(method, segment string, nodeType int) *node {
+	n := &node{
+		method:         method,
+		segment:        segment,
+		nodeType:       nodeType,
+		staticChildren: make(map[string]*node),
+	}
+	if r.owned != nil {
+		r.owned[n] = true
+	}
+	return n
+}
+
 // Add 添加一个或多个路由规则
 func (r *Router) Add(patterns ...string) {
 	for _, endpoint := range patterns {
@@ -73,16 +119,13 @@ func (r *Router) Add(patterns ...string) {
 
 			root, ok := r.roots[method]
 			if !ok {
-				root = &node{
-					method:         method,
-					segment:        "/",
-					nodeType:       nodeTypeStatic,
-					staticChildren: make(map[string]*node),
-				}
-				r.roots[method] = root
+				root = r.newNode(method, "/", nodeTypeStatic)
+			} else {
+				root = r.own(root)
 			}
+			r.roots[method] = root
 			// 添加到路由树
-			root.addRoute(method, pathSegments, pattern, queryPart, queryParams, wildcardCnt)
+			root.addRoute(r, method, pathSegments, pattern, queryPart, queryParams, wildcardCnt)
 		}
 	}
 }
@@ -107,22 +150,7 @@ func (r *Router) match(method string, fullPath string) (pattern string, params m
 	actualQueryParams := parseActualQueryParams(queryPart)
 
 	// 创建参数映射
-	params = make(map[string]any)
-
-	// 添加通配符参数（$0, $1, ...）
-	for i, val := range wildcardValues {
-		params[fmt.Sprintf("$%d", i)] = val
-	}
-
-	// 添加路径参数
-	for k, v := range pathParams {
-		params[k] = v
-	}
-
-	// 添加查询参数
-	for k, v := range actualQueryParams {
-		params[k] = v
-	}
+	params = buildParams(wildcardValues, pathParams, actualQueryParams)
 
 	// 检查查询参数匹配
 	if !matchQueryParams(leafNode.queryParams, actualQueryParams) {
@@ -171,22 +199,7 @@ func (r *Router) matchPath(method string, fullPath string) (pattern string, para
 	actualQueryParams := parseActualQueryParams(queryPart)
 
 	// 创建参数映射
-	params = make(map[string]any)
-
-	// 添加通配符参数（$0, $1, ...）
-	for i, val := range wildcardValues {
-		params[fmt.Sprintf("$%d", i)] = val
-	}
-
-	// 添加路径参数
-	for k, v := range pathParams {
-		params[k] = v
-	}
-
-	// 添加查询参数（提取所有查询参数值）
-	for k, v := range actualQueryParams {
-		params[k] = v
-	}
+	params = buildParams(wildcardValues, pathParams, actualQueryParams)
 
 	// 返回完整模式
 	return leadfNodePattern(leafNode), params, nil
@@ -210,6 +223,104 @@ func (r *Router) MatchPath(endpoint string) (pattern string, params map[string]a
 	return pattern, params, err
 }
 
+// buildParams 合并通配符、路径与查询参数
+//
+// 每个参数都会以 "来源.参数名" 写入(如 path.userId / query.userId / wildcard.0)，
+// 不带来源的参数名按 path > wildcard > query 的优先级取值，避免查询参数覆盖同名路径参数
+//
+// 重复的查询参数(如 ?tag=a&tag=b) 写入 []string ，只出现一次时为 string
+func buildParams(wildcardValues []string, pathParams map[string]string, queryParams map[string][]string) map[string]any {
+	params := make(map[string]any)
+
+	// 查询参数优先级最低，最先写入
+	for k, vals := range queryParams {
+		if source, _, ok := strings.Cut(k, "."); ok && ctx.IsParamSource(source) {
+			// 丢弃 ?path.userId=1 这类参数，避免伪造或覆盖带来源的参数
+			continue
+		}
+		var v any = vals[0]
+		if len(vals) > 1 {
+			v = vals
+		}
+		params[k] = v
+		params[ctx.ParamSourceQuery+"."+k] = v
+	}
+
+	// 通配符参数（$0, $1, ...）
+	for i, val := range wildcardValues {
+		name := strconv.Itoa(i)
+		params[name] = val
+		params[ctx.ParamSourceWildcard+"."+name] = val
+	}
+
+	// 路径参数优先级最高
+	for k, v := range pathParams {
+		params[k] = v
+		params[ctx.ParamSourcePath+"."+k] = v
+	}
+
+	return params
+}
+
+// ParamCollision 检查查询参数是否与路径参数(或通配符参数)同名
+//
+// 存在冲突时返回冲突的参数名(按字典序取第一个)
+func ParamCollision(params map[string]any) (string, bool) {
+	names := []string{}
+	queryPrefix := ctx.ParamSourceQuery + "."
+	for k := range params {
+		name, ok := strings.CutPrefix(k, queryPrefix)
+		if !ok {
+			continue
+		}
+		_, inPath := params[ctx.ParamSourcePath+"."+name]
+		_, inWildcard := params[ctx.ParamSourceWildcard+"."+name]
+		if inPath || inWildcard {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", false
+	}
+	sort.Strings(names)
+	return names[0], true
+}
+
+// PatternParams 端点表达式声明的参数
+//
+// 与 buildParams 一致，同时包含不带来源和带来源的参数名，如 userId / path.userId / 0 / wildcard.0
+func PatternParams(endpoint string) map[string]bool {
+	_, pattern := splitMethodAndPattern(endpoint)
+	pathPart, queryPart := splitPathAndQuery(pattern)
+
+	params := make(map[string]bool)
+	wildcardCount := 0
+	for _, seg := range splitPath(pathPart) {
+		switch {
+		case seg == "*":
+			name := strconv.Itoa(wildcardCount)
+			params[name] = true
+			params[ctx.ParamSourceWildcard+"."+name] = true
+			wildcardCount++
+		case strings.HasPrefix(seg, ":"):
+			params[seg[1:]] = true
+			params[ctx.ParamSourcePath+"."+seg[1:]] = true
+		}
+	}
+
+	// 查询参数按参数名取值，变量名与参数名不同时(如 q=:query) 两者都视为已声明
+	values, _ := urlParseQuery(queryPart)
+	for key := range values {
+		params[key] = true
+		params[ctx.ParamSourceQuery+"."+key] = true
+	}
+	for name := range parseQueryParams(queryPart) {
+		params[name] = true
+		params[ctx.ParamSourceQuery+"."+name] = true
+	}
+	return params
+}
+
 func leadfNodePattern(leafNode *node) string {
 	return strings.Trim(fmt.Sprintf("%s %s", leafNode.method, leafNode.pattern), " ")
 }
@@ -230,7 +341,7 @@ func splitMethodAndPattern(endpoint string) ([]string, string) {
 }
 
 // 检查查询参数是否匹配
-func matchQueryParams(ruleParams map[string]bool, actualParams map[string]string) bool {
+func matchQueryParams(ruleParams map[string]bool, actualParams map[string][]string) bool {
 	// 规则中定义了查询参数变量，则实际URL必须包含这些参数
 	for param := range ruleParams {
 		found := false
@@ -288,9 +399,9 @@ func parseQueryParams(query string) map[string]bool {
 	return params
 }
 
-// parseActualQueryParams 解析实际URL的查询参数
-func parseActualQueryParams(query string) map[string]string {
-	params := make(map[string]string)
+// parseActualQueryParams 解析实际URL的查询参数，保留重复参数的全部值
+func parseActualQueryParams(query string) map[string][]string {
+	params := make(map[string][]string)
 	if query == "" {
 		return params
 	}
@@ -298,7 +409,7 @@ func parseActualQueryParams(query string) map[string]string {
 	values, _ := urlParseQuery(query)
 	for key, vals := range values {
 		if len(vals) > 0 {
-			params[key] = vals[0]
+			params[key] = vals
 		}
 	}
 	return params
@@ -355,7 +466,9 @@ func countWildcards(segments []string) int {
 }
 
 // addRoute 添加路由到节点
-func (n *node) addRoute(method string, segments []string, pattern, queryPart string, queryParams map[string]bool, wildcardCnt int) {
+//
+// n 必须属于路由树 r ，子节点在修改前通过 r.own 复制
+func (n *node) addRoute(r *Router, method string, segments []string, pattern, queryPart string, queryParams map[string]bool, wildcardCnt int) {
 	if len(segments) == 0 {
 		// 叶节点：保存完整信息
 		n.method = method
@@ -372,32 +485,27 @@ func (n *node) addRoute(method string, segments []string, pattern, queryPart str
 	switch {
 	case currentSeg == "*": // 通配符节点
 		if n.wildcard == nil {
-			n.wildcard = &node{
-				method:         method,
-				segment:        "*",
-				nodeType:       nodeTypeWildcard,
-				staticChildren: make(map[string]*node),
-			}
+			n.wildcard = r.newNode(method, "*", nodeTypeWildcard)
+		} else {
+			n.wildcard = r.own(n.wildcard)
 		}
-		n.wildcard.addRoute(method, remaining, pattern, queryPart, queryParams, wildcardCnt)
+		n.wildcard.addRoute(r, method, remaining, pattern, queryPart, queryParams, wildcardCnt)
 
 	case strings.HasPrefix(currentSeg, ":"): // 参数节点
 		paramName := currentSeg[1:]
 		if n.paramChild == nil {
-			n.paramChild = &node{
-				method:         method,
-				segment:        currentSeg,
-				nodeType:       nodeTypeParam,
-				staticChildren: make(map[string]*node),
-			}
+			n.paramChild = r.newNode(method, currentSeg, nodeTypeParam)
 
 			// 记录参数名
 			n.paramNames = append(n.paramNames, paramName)
-		} else if n.paramChild.segment != currentSeg {
-			log.Printf("Warning: Endpoint ( %s ) node \"%s\" conflicts with existing node \"%s\", which may cause parameter errors\n", pattern, currentSeg, n.paramChild.segment)
-			log.Printf("fix endpoint use \"%s\" replace \"%s\" \n", strings.ReplaceAll(pattern, currentSeg, n.paramChild.segment), pattern)
+		} else {
+			if n.paramChild.segment != currentSeg {
+				log.Printf("Warning: Endpoint ( %s ) node \"%s\" conflicts with existing node \"%s\", which may cause parameter errors\n", pattern, currentSeg, n.paramChild.segment)
+				log.Printf("fix endpoint use \"%s\" replace \"%s\" \n", strings.ReplaceAll(pattern, currentSeg, n.paramChild.segment), pattern)
+			}
+			n.paramChild = r.own(n.paramChild)
 		}
-		n.paramChild.addRoute(method, remaining, pattern, queryPart, queryParams, wildcardCnt)
+		n.paramChild.addRoute(r, method, remaining, pattern, queryPart, queryParams, wildcardCnt)
 
 	default: // 静态节点
 		// 初始化staticChildren映射（如果尚未初始化）
@@ -408,15 +516,12 @@ func (n *node) addRoute(method string, segments []string, pattern, queryPart str
 		// 查找或创建静态子节点
 		child, exists := n.staticChildren[currentSeg]
 		if !exists {
-			child = &node{
-				method:         method,
-				segment:        currentSeg,
-				nodeType:       nodeTypeStatic,
-				staticChildren: make(map[string]*node),
-			}
-			n.staticChildren[currentSeg] = child
+			child = r.newNode(method, currentSeg, nodeTypeStatic)
+		} else {
+			child = r.own(child)
 		}
-		child.addRoute(method, remaining, pattern, queryPart, queryParams, wildcardCnt)
+		n.staticChildren[currentSeg] = child
+		child.addRoute(r, method, remaining, pattern, queryPart, queryParams, wildcardCnt)
 	}
 }
 
@@ -120,3 +120,43 @@ func TestTree(t *testing.T) {
 		fmt.Println()
 	}
 }
+
+func TestRouterWith(t *testing.T) {
+	base := NewRouter([]string{"GET /orders/:orderId", "/files/*"})
+	next := base.With("GET /orders/:orderId/items", "POST /orders/:orderId", "/files/public/:name")
+
+	testCases := []struct {
+		path string
+		// 原路由树 / 新路由树的匹配结果，为空表示不匹配
+		base, next string
+	}{
+		{"GET /orders/1", "GET /orders/:orderId", "GET /orders/:orderId"},
+		{"GET /orders/1/items", "", "GET /orders/:orderId/items"},
+		{"POST /orders/1", "", "POST /orders/:orderId"},
+		{"GET /files/public/a.png", "/files/*", "/files/public/:name"},
+		{"GET /files/private/a.png", "/files/*", "/files/*"},
+	}
+	for _, tc := range testCases {
+		for name, expected := range map[string]string{"base": tc.base, "next": tc.next} {
+			router := base
+			if name == "next" {
+				router = next
+			}
+			pattern, _, err := router.MatchPath(tc.path)
+			if expected == "" {
+				if err == nil {
+					t.Errorf("%s %s: expected no match, got %s", name, tc.path, pattern)
+				}
+				continue
+			}
+			if err != nil || pattern != expected {
+				t.Errorf("%s %s: expected %s, got %s, %v", name, tc.path, expected, pattern, err)
+			}
+		}
+	}
+
+	// 共享的节点仍然可以取到参数
+	if _, params, _ := next.MatchPath("GET /orders/7/items"); params["orderId"] != "7" {
+		t.Errorf("Expected orderId 7, got %v", params)
+	}
+}
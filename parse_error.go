@@ -0,0 +1,42 @@
+package security
+
+import "github.com/einsitang/go-security/internal/expr"
+
+// 表达式解析错误
+//
+// 包含错误码、出错的 token 及其位置(字节偏移 / 行号 / 列号)
+type ParseError = expr.ParseError
+
+// 一次解析中的全部错误，按位置排列
+//
+// NewGuard / AddEndpoint 等解析表达式出错时返回，解析器会跳过出错的部分继续解析，一次报告全部错误；
+// 用 errors.As 取出全部错误 (*ParseErrors) 或第一个错误 (**ParseError)
+type ParseErrors = expr.ParseErrors
+
+// 解析错误码
+type ParseErrorCode = expr.ParseErrorCode
+
+const (
+	// 缺少 allow: / deny: 策略
+	CodeInvalidPolicy = expr.CodeInvalidPolicy
+	// 语法错误: 多余的 token、缺少操作数等
+	CodeSyntax = expr.CodeSyntax
+	// 括号不匹配
+	CodeUnbalancedParen = expr.CodeUnbalancedParen
+	// 操作数类型不符合操作符要求
+	CodeMismatchedTypes = expr.CodeMismatchedTypes
+	// 函数参数个数、类型或取值错误
+	CodeInvalidArgument = expr.CodeInvalidArgument
+	// 未知的函数
+	CodeUnknownFunction = expr.CodeUnknownFunction
+	// 错误的参数 / 当事人属性 / 访问路径
+	CodeInvalidReference = expr.CodeInvalidReference
+	// 错误的常量或列表
+	CodeInvalidLiteral = expr.CodeInvalidLiteral
+	// 表达式的结果不是布尔值
+	CodeNonBoolean = expr.CodeNonBoolean
+	// 端点不会提供的 $ 参数
+	CodeUndefinedParam = expr.CodeUndefinedParam
+	// 比较的类型永远不会匹配，仅作为警告 (Guard.Warnings)
+	CodeIncomparableTypes = expr.CodeIncomparableTypes
+)
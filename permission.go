@@ -0,0 +1,26 @@
+package security
+
+import "github.com/einsitang/go-security/internal/expr/snytax/value"
+
+// 持有的权限 held 是否蕴含要求的权限 required (Shiro 风格通配符权限)
+//
+// 权限格式为 domain:action:instance , 层级数不限，每一层可以是 * 或用 , 分隔的多个值
+//
+// - 逐层比较，held 的每一层为 * 或者包含 required 对应层的全部值: docs:read,write 蕴含 docs:read
+//
+// - held 层数较少时，缺少的层视为 * : orders 蕴含 orders:read:1
+//
+// - held 层数较多时，多出来的层必须为 * : orders:read:* 蕴含 orders:read , orders:read:1 不蕴含 orders:read
+//
+// 区分大小写，任意一方格式错误(如存在空的层 orders::read)时返回 false
+func PermissionImplies(held string, required string) bool {
+	h, err := value.ParseWildcardPermission(held)
+	if err != nil {
+		return false
+	}
+	r, err := value.ParseWildcardPermission(required)
+	if err != nil {
+		return false
+	}
+	return h.Implies(r)
+}
@@ -0,0 +1,27 @@
+package security
+
+import "github.com/einsitang/go-security/internal/expr/snytax/value"
+
+// 角色继承
+//
+// 高级角色蕴含低级角色，如 admin > manager > user 时 Role('manager') 对 admin 也成立
+//
+// 创建时检查循环继承并预先计算传递闭包，创建后只读，可以在多个 Guard / Sentinel 之间共享
+type RoleHierarchy = value.RoleHierarchy
+
+// 根据 角色 => 直接蕴含的角色 创建角色继承，如
+//
+//	security.NewRoleHierarchy(map[string][]string{
+//		"admin":   {"manager", "auditor"},
+//		"manager": {"user"},
+//	})
+func NewRoleHierarchy(inherits map[string][]string) (*RoleHierarchy, error) {
+	return value.NewRoleHierarchy(inherits)
+}
+
+// 解析文本格式的角色继承
+//
+// 每行一条继承链，如 admin > manager > user , # 开头的行为注释
+func ParseRoleHierarchy(text string) (*RoleHierarchy, error) {
+	return value.ParseRoleHierarchy(text)
+}
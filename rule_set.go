@@ -0,0 +1,103 @@
+package security
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/einsitang/go-security/internal/parse"
+)
+
+// 端点规则
+//
+// Endpoint: 端点表达式； Express: 检查表达式
+type Rule struct {
+	Endpoint string
+	Express  string
+}
+
+// 规则快照
+//
+// 快照一旦发布(sentinel.rules.Store)就只读，任何修改都基于 clone 出来的新快照进行
+type ruleSet struct {
+	router *parse.Router
+	guards map[string]Guard
+	// build 之前新添加的端点
+	pending []string
+	// build 之前新添加规则的警告
+	warnings []ruleWarnings
+}
+
+// 规则创建时类型检查的警告
+type ruleWarnings struct {
+	endpoint string
+	warnings []*ParseError
+}
+
+func newRuleSet() *ruleSet {
+	return &ruleSet{
+		router: parse.NewRouter([]string{}),
+		guards: map[string]Guard{},
+	}
+}
+
+// 复制快照，返回的快照在 build 之前不可用于检查
+//
+// 路由表与原快照共享，build 时写时复制
+func (rs *ruleSet) clone() *ruleSet {
+	return &ruleSet{
+		router: rs.router,
+		guards: maps.Clone(rs.guards),
+	}
+}
+
+// 添加规则，路由表在 build 时统一生成
+func (rs *ruleSet) add(endpoint string, express string, options ...GuardOption) error {
+	var methods []string
+	methodStr, pattern, ok := strings.Cut(endpoint, " ")
+	if !ok {
+		methods = []string{""}
+		pattern = endpoint
+	} else {
+		methods = strings.Split(strings.Trim(methodStr, "/"), "/")
+	}
+
+	pattern = strings.Trim(pattern, " ")
+	// $ 参数必须由端点提供
+	options = append(options, withEndpoint(pattern))
+
+	var warnings []*ParseError
+	for _, method := range methods {
+		// 与路由表保持一致，方法统一大写
+		key := strings.ToUpper(method) + " " + pattern
+		key = strings.Trim(key, " ")
+		if _, ok := rs.guards[key]; ok {
+			return fmt.Errorf("endpoint %s already exists", key)
+		}
+
+		guard, err := NewGuard(express, options...)
+		if err != nil {
+			return err
+		}
+
+		rs.guards[key] = guard
+		// 同一条规则的各个方法警告相同
+		warnings = guard.Warnings()
+	}
+
+	rs.pending = append(rs.pending, endpoint)
+	if len(warnings) > 0 {
+		rs.warnings = append(rs.warnings, ruleWarnings{endpoint: endpoint, warnings: warnings})
+	}
+	return nil
+}
+
+// 生成路由表
+//
+// 只把新添加的端点插入原路由表的副本，不重建整个路由表
+func (rs *ruleSet) build() *ruleSet {
+	rs.router = rs.router.With(rs.pending...)
+	rs.pending = nil
+	rs.warnings = nil
+	return rs
+}
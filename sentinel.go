@@ -5,35 +5,87 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/einsitang/go-security/internal/expr"
 	"github.com/einsitang/go-security/internal/expr/ctx"
+	"github.com/einsitang/go-security/internal/expr/snytax/value"
 	"github.com/einsitang/go-security/internal/parse"
 )
 
 type SecurityPrincipal ctx.Principal
+
+// 带属性的当事人, 表达式可以通过 principal.name 访问 Attributes() 中的属性
+type AttributedPrincipal ctx.AttributedPrincipal
 type SecurityContext ctx.Context
 
+// 当前时间，设置了 Clock 时使用 Clock ，自定义函数需要当前时间时应使用该方法
+func (c *SecurityContext) Now() time.Time {
+	return (*ctx.Context)(c).Now()
+}
+
 // endpoint not found error
 //
 // only for sentinel.Check function will return this error
 type EndpointNotFoundError error
 
+// param collision error
+//
+// only return when sentinel enable WithParamCollisionError option,
+// a query parameter has the same name as a path (or wildcard) parameter
+type ParamCollisionError error
+
+// path not found error
+//
+// Check returns it when an access path such as $order.customer.id or #items[0] can not be resolved,
+// use errors.As to get the path and the unresolved segment
+type MissingPathError = value.MissingPathError
+
+// 端点未命中规则时的默认策略
+//
+// 同时作用于 路由未命中 和 路由命中但该方法没有规则 两种情况
+type DefaultPolicy string
+
+const (
+	// 放行
+	DefaultAllow DefaultPolicy = "allow"
+	// 拒绝
+	DefaultDeny DefaultPolicy = "deny"
+	// 返回 EndpointNotFoundError (默认)
+	DefaultError DefaultPolicy = "error"
+)
+
+// 端点未命中规则时的回调
+//
+// 返回值即为 Check / StrictCheck 的结果
+type UnmatchedHandler func(endpoint string, principal SecurityPrincipal) (pass bool, err error)
+
+// 规则创建时类型检查的警告回调，如永远不会成立的比较 $a > 'abc'
+//
+// 规则成功发布后调用，endpoint 为规则的端点表达式
+type WarningHandler func(endpoint string, warnings []*ParseError)
+
 // 哨兵
 //
 // 看守全局路由的哨兵模式
+//
+// 并发安全: 检查读取不可变的规则快照, AddEndpoint / Replace / CleanEndpoints 会生成新快照并原子发布
 type Sentinel interface {
 
 	/*
 		添加检查点
 
 		pattern: 端点表达式； express: 检查表达式
+
+		每次调用都会生成新快照: 路由表只插入新端点，但端点规则表需要整体复制一次，
+		批量加载大量规则时使用 Replace (或 WithConfig) 一次完成
 	*/
 	AddEndpoint(pattern string, express string) error
 
 	/*
-		检查 用户(principal) 在端点(endpoint) 内是否符合通行规则
-
-		customParams 为自定义参数(可为nil),用于根据实际情况传递给表达式进行逻辑计算
+		检查 用户(context.Principal) 在端点(endpoint) 内是否符合通行规则
 
 		如果该端点命中规则表达式，则返回 true,nil , 否则返回 false,nil
 
@@ -42,8 +94,13 @@ type Sentinel interface {
 		- 没有建立规则
 
 		- 规则执行错误，大概率是因为类型转换问题，因为规则在AddEndpoint阶段会编译AST,如果出错会在这个环节报 error
+
+		context 提供 当事人、自定义参数(CustomParams / CustomValues) 及时钟，context.Params 由路由结果填充；
+		strict 为 true 时严格检查QueryParams参数
+
+		Check / StrictCheck / CheckWith 都委托给该方法，Decide / StrictDecide / DecideWith 以相同的参数委托给 decide
 	*/
-	check(endpoint string, principal SecurityPrincipal, customParams map[string]string, strict bool) (pass bool, err error)
+	check(endpoint string, context *SecurityContext, strict bool) (pass bool, err error)
 
 	/*
 		检查 用户(principal) 在端点(endpoint) 内是否符合通行规则
@@ -52,7 +109,7 @@ type Sentinel interface {
 
 		端点匹配时不检查QueryParams参数
 
-		该方法实际执行 check(endpoint,principal,false)
+		该方法实际执行 check(endpoint, &SecurityContext{Principal: principal, CustomParams: customParams}, false)
 
 		碰到 err != nil 应该忽略 pass 值
 	*/
@@ -65,70 +122,231 @@ type Sentinel interface {
 
 		端点匹配时严格检查QueryParams参数
 
-		该方法实际执行 check(endpoint,principal,customParams,true)
+		该方法实际执行 check(endpoint, &SecurityContext{Principal: principal, CustomParams: customParams}, true)
 
 		碰到 err != nil 应该忽略 pass 值
 	*/
 	StrictCheck(endpoint string, principal SecurityPrincipal, customParams map[string]string) (pass bool, err error)
 
+	/*
+		与 Check 相同，返回详细的检查结果 Decision : 命中的端点、方法、策略、表达式、参数及耗时
+
+		碰到 err != nil 应该忽略 Decision.Allowed 值
+	*/
+	Decide(endpoint string, principal SecurityPrincipal, customParams map[string]string) (*Decision, error)
+
+	/*
+		与 StrictCheck 相同，返回详细的检查结果 Decision
+
+		碰到 err != nil 应该忽略 Decision.Allowed 值
+	*/
+	StrictDecide(endpoint string, principal SecurityPrincipal, customParams map[string]string) (*Decision, error)
+
+	/*
+		与 Check / StrictCheck 相同，自定义参数保留原始类型(数字、布尔、时间、嵌套对象等)，不需要转换为字符串
+
+		opts.Strict 为 true 时严格检查QueryParams参数
+
+		该方法实际执行 check(endpoint, &SecurityContext{Principal: principal, CustomValues: opts.CustomParams, Clock: opts.Clock}, opts.Strict)
+
+		碰到 err != nil 应该忽略 pass 值
+	*/
+	CheckWith(endpoint string, principal SecurityPrincipal, opts CheckOptions) (pass bool, err error)
+
+	/*
+		与 CheckWith 相同，返回详细的检查结果 Decision
+
+		碰到 err != nil 应该忽略 Decision.Allowed 值
+	*/
+	DecideWith(endpoint string, principal SecurityPrincipal, opts CheckOptions) (*Decision, error)
+
+	/*
+		替换全部检查端点
+
+		新规则全部编译成功后才会原子地替换当前规则，检查过程中不会出现规则表为空或只加载了一部分的情况
+
+		任意一条规则出错则返回 error , 当前规则保持不变
+	*/
+	Replace(rules []Rule) error
+
+	/*
+		注册自定义函数，表达式中可以通过 name(...) 调用
+
+		只对之后添加的规则生效; name 不能与关键字、内置函数或已注册的函数重名
+	*/
+	RegisterFunction(name string, signature Signature, impl FunctionImpl) error
+
 	// 清空所有检查端点
 	CleanEndpoints()
 }
 
 type sentinel struct {
-	router *parse.Router
-	guards map[string]Guard
+	// 当前生效的规则快照，检查时只读
+	rules atomic.Pointer[ruleSet]
+
+	// 串行化规则修改
+	mu sync.Mutex
+
+	// 查询参数与路径参数同名时返回错误
+	rejectParamCollision bool
+
+	// 端点未命中规则时的默认策略
+	defaultPolicy DefaultPolicy
+
+	// 端点未命中规则时的回调，设置后优先于 defaultPolicy
+	unmatchedHandler UnmatchedHandler
+
+	// 规则警告回调，为 nil 时忽略警告
+	warningHandler WarningHandler
+
+	// 表达式解析器，包含注册的自定义函数; 由 mu 保护
+	analyzer expr.SyntaxAnalyzer
+
+	// WithConfig 读取的规则，所有选项生效后再加载
+	configRules []Rule
 }
 
-func (p *sentinel) AddEndpoint(endpoint string, express string) error {
+// 基于当前快照修改规则，成功后原子发布新快照
+//
+// 修改失败时当前快照保持不变
+func (p *sentinel) update(fn func(rs *ruleSet) error) error {
+	return p.publish(func() *ruleSet { return p.rules.Load().clone() }, fn)
+}
 
-	p.router.Add(endpoint)
+// 在 base 返回的快照上修改规则，成功后原子发布
+//
+// 新规则的警告在释放锁之后交给 warningHandler ，回调中可以再修改规则
+func (p *sentinel) publish(base func() *ruleSet, fn func(rs *ruleSet) error) error {
+	p.mu.Lock()
+	next := base()
+	if err := fn(next); err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	warnings := next.warnings
+	p.rules.Store(next.build())
+	p.mu.Unlock()
 
-	var methods []string
-	methodStr, pattern, ok := strings.Cut(endpoint, " ")
-	if !ok {
-		methods = []string{""}
-		pattern = endpoint
-	} else {
-		methods = strings.Split(strings.Trim(methodStr, "/"), "/")
+	if p.warningHandler != nil {
+		for _, w := range warnings {
+			p.warningHandler(w.endpoint, w.warnings)
+		}
 	}
+	return nil
+}
+
+func (p *sentinel) AddEndpoint(endpoint string, express string) error {
+	return p.update(func(rs *ruleSet) error {
+		return rs.add(endpoint, express, withAnalyzer(p.analyzer))
+	})
+}
 
-	for _, method := range methods {
-		key := method + " " + pattern
-		key = strings.Trim(key, " ")
-		if _, ok := p.guards[key]; ok {
-			return fmt.Errorf("endpoint %s already exists", key)
+func (p *sentinel) addRules(rules []Rule) error {
+	return p.update(func(rs *ruleSet) error {
+		for _, rule := range rules {
+			if err := rs.add(rule.Endpoint, rule.Express, withAnalyzer(p.analyzer)); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+}
 
-		guard, err := NewGuard(express)
-		if err != nil {
-			return err
+func (p *sentinel) Replace(rules []Rule) error {
+	return p.publish(newRuleSet, func(rs *ruleSet) error {
+		for _, rule := range rules {
+			if err := rs.add(rule.Endpoint, rule.Express, withAnalyzer(p.analyzer)); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+}
 
-		p.guards[key] = guard
+func (p *sentinel) RegisterFunction(name string, signature Signature, impl FunctionImpl) error {
+	fn, err := newFunction(name, signature, impl)
+	if err != nil {
+		return err
 	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_analyzer, err := p.analyzer.WithFunctions(fn)
+	if err != nil {
+		return err
+	}
+	p.analyzer = _analyzer
 	return nil
 }
 
+// CheckWith / DecideWith 的选项
+type CheckOptions struct {
+	// 严格检查QueryParams参数，同 StrictCheck
+	Strict bool
+
+	// 自定义参数(可为nil)，保留原始类型
+	CustomParams map[string]any
+
+	// 时钟(可为nil)，now() 的取值，默认为 time.Now
+	Clock func() time.Time
+}
+
 func (p *sentinel) Check(endpoint string, principal SecurityPrincipal, customParams map[string]string) (bool, error) {
-	return p.check(endpoint, principal, customParams, false)
+	return p.check(endpoint, &SecurityContext{Principal: principal, CustomParams: customParams}, false)
 }
 
 func (p *sentinel) StrictCheck(endpoint string, principal SecurityPrincipal, customParams map[string]string) (bool, error) {
-	return p.check(endpoint, principal, customParams, true)
+	return p.check(endpoint, &SecurityContext{Principal: principal, CustomParams: customParams}, true)
+}
+
+func (p *sentinel) CheckWith(endpoint string, principal SecurityPrincipal, opts CheckOptions) (bool, error) {
+	return p.check(endpoint, &SecurityContext{Principal: principal, CustomValues: opts.CustomParams, Clock: opts.Clock}, opts.Strict)
+}
+
+func (p *sentinel) Decide(endpoint string, principal SecurityPrincipal, customParams map[string]string) (*Decision, error) {
+	return p.decide(endpoint, &SecurityContext{Principal: principal, CustomParams: customParams}, false)
+}
+
+func (p *sentinel) StrictDecide(endpoint string, principal SecurityPrincipal, customParams map[string]string) (*Decision, error) {
+	return p.decide(endpoint, &SecurityContext{Principal: principal, CustomParams: customParams}, true)
+}
+
+func (p *sentinel) DecideWith(endpoint string, principal SecurityPrincipal, opts CheckOptions) (*Decision, error) {
+	return p.decide(endpoint, &SecurityContext{Principal: principal, CustomValues: opts.CustomParams, Clock: opts.Clock}, opts.Strict)
 }
 
-func (p *sentinel) check(endpoint string, principal SecurityPrincipal, customParams map[string]string, strict bool) (bool, error) {
+// 端点路由结果
+type route struct {
+	// 命中的端点表达式(含方法)
+	pattern string
+	params  map[string]any
+	// 为 nil 表示端点未命中规则
+	guard Guard
+	// 未命中原因
+	cause error
+}
+
+// 查找端点对应的规则
+//
+// 端点未命中规则时 route.guard 为 nil ; error 仅在参数冲突时返回
+func (p *sentinel) route(endpoint string, strict bool) (*route, error) {
+	rs := p.rules.Load()
+
 	var matchFn func(endpoint string) (pattern string, params map[string]any, err parse.NotMatchRouterError)
 	if strict {
-		matchFn = p.router.Match
+		matchFn = rs.router.Match
 	} else {
-		matchFn = p.router.MatchPath
+		matchFn = rs.router.MatchPath
 	}
 	pattern, params, notMatchError := matchFn(endpoint)
 	if notMatchError != nil {
+		return &route{cause: notMatchError}, nil
+	}
 
-		return false, EndpointNotFoundError(notMatchError)
+	if p.rejectParamCollision {
+		if name, ok := parse.ParamCollision(params); ok {
+			return nil, ParamCollisionError(fmt.Errorf("query parameter \"%s\" collides with path parameter of endpoint %s", name, pattern))
+		}
 	}
 
 	var key string
@@ -139,46 +357,224 @@ func (p *sentinel) check(endpoint string, principal SecurityPrincipal, customPar
 		key = method + " " + pattern
 	}
 
-	guard, ok := p.guards[key]
+	guard, ok := rs.guards[key]
 	if !ok && key != pattern {
 		// 尝试匹配空方法
-		guard, ok = p.guards[pattern]
-		if !ok {
-			// 没有匹配上
-			return true, nil
+		guard, ok = rs.guards[pattern]
+	}
+	if !ok {
+		// 路由命中但没有对应的 guard , 与路由未命中按相同策略处理
+		return &route{pattern: pattern, params: params, cause: fmt.Errorf("no guard found for route: %s", pattern)}, nil
+	}
+
+	return &route{pattern: pattern, params: params, guard: guard}, nil
+}
+
+func (p *sentinel) check(endpoint string, context *SecurityContext, strict bool) (bool, error) {
+	r, err := p.route(endpoint, strict)
+	if err != nil {
+		return false, err
+	}
+	if r.guard == nil {
+		return p.unmatched(endpoint, context.Principal, r.cause)
+	}
+
+	context.Params = r.params
+	return r.guard.Check(context)
+}
+
+func (p *sentinel) decide(endpoint string, context *SecurityContext, strict bool) (*Decision, error) {
+	start := time.Now()
+	r, err := p.route(endpoint, strict)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.guard == nil {
+		allowed, err := p.unmatched(endpoint, context.Principal, r.cause)
+		decision := &Decision{
+			Allowed: allowed,
+			Params:  decisionParams(r.params, context.CustomParams, context.CustomValues),
+		}
+		if p.unmatchedHandler == nil {
+			decision.Policy = string(p.defaultPolicy)
 		}
+		decision.Method, decision.Pattern = splitRoutePattern(r.pattern)
+		decision.Duration = time.Since(start)
+		return decision, err
 	}
 
-	return guard.Check(&SecurityContext{
-		Params:       params,
-		Principal:    principal,
-		CustomParams: customParams,
-	})
+	context.Params = r.params
+	decision, err := r.guard.Decide(context)
+	decision.Method, decision.Pattern = splitRoutePattern(r.pattern)
+	decision.Duration = time.Since(start)
+	return decision, err
+}
+
+// 拆分路由返回的端点表达式为 方法 和 路径表达式
+func splitRoutePattern(pattern string) (method string, path string) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		return "", pattern
+	}
+	return method, path
+}
+
+// 端点未命中规则时的处理
+//
+// 优先交给 unmatchedHandler , 否则按 defaultPolicy 处理
+func (p *sentinel) unmatched(endpoint string, principal SecurityPrincipal, cause error) (bool, error) {
+	if p.unmatchedHandler != nil {
+		return p.unmatchedHandler(endpoint, principal)
+	}
+	switch p.defaultPolicy {
+	case DefaultAllow:
+		return true, nil
+	case DefaultDeny:
+		return false, nil
+	}
+	return false, EndpointNotFoundError(cause)
 }
 
 func (p *sentinel) CleanEndpoints() {
-	p.router = parse.NewRouter([]string{})
-	p.guards = map[string]Guard{}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules.Store(newRuleSet())
 }
 
 func NewSentinel(options ...SentinelOption) (Sentinel, error) {
 
 	p := &sentinel{
-		router: parse.NewRouter([]string{}),
-		guards: map[string]Guard{},
+		defaultPolicy: DefaultError,
+		analyzer:      analyzer,
 	}
+	p.rules.Store(newRuleSet())
 
 	for _, option := range options {
 		if err := option(p); err != nil {
 			return nil, err
 		}
 	}
+	// 配置规则在所有选项之后加载，WithDecimal / WithFunction 等选项与 WithConfig 的先后顺序无关
+	if len(p.configRules) > 0 {
+		// 一次性加载，只生成一次路由表
+		if err := p.addRules(p.configRules); err != nil {
+			return nil, err
+		}
+		p.configRules = nil
+	}
 
 	return p, nil
 }
 
 type SentinelOption func(p *sentinel) error
 
+// 查询参数与路径参数(或通配符参数)同名时，Check / StrictCheck 返回 ParamCollisionError
+//
+// 默认情况下路径参数优先，同名的查询参数只能通过 $query.name 访问
+func WithParamCollisionError() SentinelOption {
+	return func(p *sentinel) error {
+		p.rejectParamCollision = true
+		return nil
+	}
+}
+
+// 设置端点未命中规则时的默认策略: DefaultAllow / DefaultDeny / DefaultError (默认)
+func WithDefaultPolicy(policy DefaultPolicy) SentinelOption {
+	return func(p *sentinel) error {
+		switch policy {
+		case DefaultAllow, DefaultDeny, DefaultError:
+			p.defaultPolicy = policy
+			return nil
+		}
+		return fmt.Errorf("invalid default policy \"%s\", expect allow / deny / error", policy)
+	}
+}
+
+// 设置端点未命中规则时的回调，设置后 WithDefaultPolicy 不再生效
+func WithUnmatchedHandler(handler UnmatchedHandler) SentinelOption {
+	return func(p *sentinel) error {
+		p.unmatchedHandler = handler
+		return nil
+	}
+}
+
+// 注册自定义函数
+func WithFunction(name string, signature Signature, impl FunctionImpl) SentinelOption {
+	return func(p *sentinel) error {
+		return p.RegisterFunction(name, signature, impl)
+	}
+}
+
+// Permission / Permissions 按通配符权限(domain:action:instance)匹配
+//
+// 匹配规则见 PermissionImplies
+func WithWildcardPermission() SentinelOption {
+	return func(p *sentinel) error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.analyzer = p.analyzer.WithWildcardPermission()
+		return nil
+	}
+}
+
+// Role / Roles 按角色继承匹配
+func WithRoleHierarchy(hierarchy *RoleHierarchy) SentinelOption {
+	return func(p *sentinel) error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.analyzer = p.analyzer.WithRoleHierarchy(hierarchy)
+		return nil
+	}
+}
+
+// 数值运算 / 比较按十进制精确计算
+//
+// 如 0.1 + 0.2 == 0.3 成立，整数除法不再取整
+func WithDecimal() SentinelOption {
+	return func(p *sentinel) error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.analyzer = p.analyzer.WithDecimal()
+		return nil
+	}
+}
+
+// 比较两侧类型不同时 Check 返回 ErrTypeMismatch
+//
+// 如路径参数 $id 为 '1' 时 $id == 1 默认为 true ，开启后返回 ErrTypeMismatch ；与 null 比较不受影响
+func WithStrictTypes() SentinelOption {
+	return func(p *sentinel) error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.analyzer = p.analyzer.WithStrictTypes()
+		return nil
+	}
+}
+
+// 引用不存在的 $ / # 参数时 Check 返回 ErrMissingParam
+//
+// exists($x) / has(#x) / $x ?? 'default' 不受影响
+func WithMissingParamError() SentinelOption {
+	return func(p *sentinel) error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.analyzer = p.analyzer.WithMissingParamError()
+		return nil
+	}
+}
+
+// 设置规则的警告回调，AddEndpoint / Replace / WithConfig 添加的规则有警告时调用
+//
+// 默认忽略警告
+func WithWarningHandler(handler WarningHandler) SentinelOption {
+	return func(p *sentinel) error {
+		p.warningHandler = handler
+		return nil
+	}
+}
+
+// 从配置文件加载规则，规则在所有选项生效后加载
 func WithConfig(configPath string) SentinelOption {
 	file, err := os.Open(configPath)
 	if err != nil {
@@ -195,21 +591,31 @@ func WithConfig(configPath string) SentinelOption {
 	text := string(content)
 
 	return func(p *sentinel) error {
-		lines := strings.Split(text, "\n")
-		for lineIndex, line := range lines {
-			if strings.HasPrefix(line, "#") {
-				// 注释行 跳过
-				continue
-			}
-			endpoint, express, ok := strings.Cut(line, ",")
-			if !ok {
-				return fmt.Errorf("\"%s\" -> invalid line[#%d]: \"%s\"", configPath, lineIndex, line)
-			}
-			err := p.AddEndpoint(endpoint, express)
-			if err != nil {
-				return err
-			}
+		rules, err := parseRules(configPath, text)
+		if err != nil {
+			return err
 		}
+		p.configRules = append(p.configRules, rules...)
 		return nil
 	}
 }
+
+// 解析规则配置文本
+//
+// 每行格式为 "endpoint, express" , # 开头的行为注释
+func parseRules(configPath string, text string) ([]Rule, error) {
+	rules := []Rule{}
+	lines := strings.Split(text, "\n")
+	for lineIndex, line := range lines {
+		if strings.HasPrefix(line, "#") {
+			// 注释行 跳过
+			continue
+		}
+		endpoint, express, ok := strings.Cut(line, ",")
+		if !ok {
+			return nil, fmt.Errorf("\"%s\" -> invalid line[#%d]: \"%s\"", configPath, lineIndex, line)
+		}
+		rules = append(rules, Rule{Endpoint: endpoint, Express: express})
+	}
+	return rules, nil
+}
@@ -1,9 +1,11 @@
 package security
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"testing"
+	"time"
 )
 
 // Test principal implementation for Sentinel tests
@@ -422,6 +424,135 @@ func TestSentinel_Check_QueryParameters(t *testing.T) {
 	}
 }
 
+func TestSentinel_Check_ParamSources(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints map[string]string
+		options   []SentinelOption
+		testCases []struct {
+			endpoint  string
+			expected  bool
+			wantError bool
+		}
+	}{
+		{
+			name: "Path parameter wins over query parameter",
+			endpoints: map[string]string{
+				"GET /api/users/:userId": "allow: $userId == 'self'",
+			},
+			testCases: []struct {
+				endpoint  string
+				expected  bool
+				wantError bool
+			}{
+				{"GET /api/users/self", true, false},
+				{"GET /api/users/123?userId=self", false, false},
+			},
+		},
+		{
+			name: "Namespaced parameters",
+			endpoints: map[string]string{
+				"GET /api/users/:userId":  "allow: $path.userId == '123' and $query.userId == 'self'",
+				"GET /api/files/*":        "allow: $0 == 'public/doc.pdf' and $wildcard.0 == $0",
+				"GET /api/books/:id/tags": "allow: $query.id == 'x'",
+			},
+			testCases: []struct {
+				endpoint  string
+				expected  bool
+				wantError bool
+			}{
+				{"GET /api/users/123?userId=self", true, false},
+				{"GET /api/users/123", false, false},
+				{"GET /api/files/public/doc.pdf", true, false},
+				{"GET /api/files/secret/doc.pdf", false, false},
+				{"GET /api/books/1/tags?id=x", true, false},
+			},
+		},
+		{
+			name: "Query keys with a source prefix are dropped",
+			endpoints: map[string]string{
+				"GET /api/books":         "allow: $query.role == 'admin'",
+				"GET /api/users/:userId": "allow: $path.userId == 'self' and !exists($query.path)",
+			},
+			testCases: []struct {
+				endpoint  string
+				expected  bool
+				wantError bool
+			}{
+				{"GET /api/books?role=admin", true, false},
+				{"GET /api/books?query.role=admin", false, false},
+				{"GET /api/users/self?path.userId=x", true, false},
+				{"GET /api/users/x?path.userId=self", false, false},
+			},
+		},
+		{
+			name: "String functions on wildcard parameter",
+			endpoints: map[string]string{
+				"GET /files/*": "allow: startsWith($0, 'public/') and !contains($0, '..')",
+			},
+			testCases: []struct {
+				endpoint  string
+				expected  bool
+				wantError bool
+			}{
+				{"GET /files/public/logo.png", true, false},
+				{"GET /files/private/key.pem", false, false},
+				{"GET /files/public/../private/key.pem", false, false},
+			},
+		},
+		{
+			name: "Collision error option",
+			endpoints: map[string]string{
+				"GET /api/users/:userId": "allow: $userId == 'self'",
+			},
+			options: []SentinelOption{WithParamCollisionError()},
+			testCases: []struct {
+				endpoint  string
+				expected  bool
+				wantError bool
+			}{
+				{"GET /api/users/self", true, false},
+				{"GET /api/users/self?page=1", true, false},
+				{"GET /api/users/123?userId=self", false, true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sentinel, err := NewSentinel(tt.options...)
+			if err != nil {
+				t.Fatalf("Failed to create sentinel: %v", err)
+			}
+
+			// Add endpoints
+			for endpoint, express := range tt.endpoints {
+				err = sentinel.AddEndpoint(endpoint, express)
+				if err != nil {
+					t.Fatalf("Failed to add endpoint %s: %v", endpoint, err)
+				}
+			}
+
+			// Test cases
+			for _, tc := range tt.testCases {
+				result, err := sentinel.Check(tc.endpoint, &sentinelTestPrincipal{}, nil)
+				if tc.wantError {
+					if err == nil {
+						t.Errorf("Expected error for endpoint %s but got none", tc.endpoint)
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("Unexpected error for endpoint %s: %v", tc.endpoint, err)
+				}
+				if result != tc.expected {
+					t.Errorf("Endpoint %s: expected %v, got %v", tc.endpoint, tc.expected, result)
+				}
+			}
+		})
+	}
+}
+
 func TestSentinel_StrictCheck(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -589,6 +720,120 @@ func TestSentinel_CustomParameters(t *testing.T) {
 	}
 }
 
+func TestSentinel_TypedCustomParams(t *testing.T) {
+	type customer struct {
+		Level int `json:"level"`
+	}
+	sentinel, err := NewSentinel(WithStrictTypes())
+	if err != nil {
+		t.Fatalf("Failed to create sentinel: %v", err)
+	}
+	endpoints := map[string]string{
+		"POST /orders":         "allow: #amount <= 1000 and #verified == true",
+		"GET /orders/:orderId": "allow: #order.customer.level >= 3 and #order.id == $orderId",
+		"GET /posts?tag=:tag":  "allow: any(#tags, t -> t == $tag)",
+		"GET /prices":          "allow: #price * 2 == 0.5",
+	}
+	for endpoint, express := range endpoints {
+		if err := sentinel.AddEndpoint(endpoint, express); err != nil {
+			t.Fatalf("Failed to add endpoint %s: %v", endpoint, err)
+		}
+	}
+
+	order := map[string]any{"id": "1001", "customer": customer{Level: 3}}
+	testCases := []struct {
+		endpoint string
+		opts     CheckOptions
+		expected bool
+	}{
+		{"POST /orders", CheckOptions{CustomParams: map[string]any{"amount": 1000, "verified": true}}, true},
+		{"POST /orders", CheckOptions{CustomParams: map[string]any{"amount": int64(1001), "verified": true}}, false},
+		{"POST /orders", CheckOptions{CustomParams: map[string]any{"amount": 10.5, "verified": false}}, false},
+		{"GET /orders/1001", CheckOptions{CustomParams: map[string]any{"order": order}}, true},
+		{"GET /orders/1002", CheckOptions{CustomParams: map[string]any{"order": order}}, false},
+		{"GET /posts?tag=go", CheckOptions{CustomParams: map[string]any{"tags": []string{"rust", "go"}}}, true},
+		{"GET /posts", CheckOptions{Strict: true, CustomParams: map[string]any{"tags": []string{"go"}}}, false},
+		{"GET /prices", CheckOptions{CustomParams: map[string]any{"price": 0.25}}, true},
+	}
+	for _, tc := range testCases {
+		result, err := sentinel.CheckWith(tc.endpoint, nil, tc.opts)
+		if tc.opts.Strict {
+			// 严格匹配时查询参数缺失，端点未命中
+			if err == nil {
+				t.Errorf("Expected error for endpoint %s", tc.endpoint)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for endpoint %s: %v", tc.endpoint, err)
+			continue
+		}
+		if result != tc.expected {
+			t.Errorf("Endpoint %s: expected %v, got %v", tc.endpoint, tc.expected, result)
+		}
+	}
+
+	// 字符串形式的自定义参数仍然可用，开启严格类型时与数字比较返回错误
+	if _, err := sentinel.Check("POST /orders", nil, map[string]string{"amount": "10", "verified": "true"}); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v", err)
+	}
+
+	decision, err := sentinel.DecideWith("POST /orders", nil, CheckOptions{CustomParams: map[string]any{"amount": 10, "verified": true}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !decision.Allowed {
+		t.Error("Expected decision to be allowed")
+	}
+	for _, param := range decision.Params {
+		if param.Name == "amount" && (param.Source != ParamSourceCustom || param.Value != 10) {
+			t.Errorf("Expected custom param amount = 10, got %+v", param)
+		}
+	}
+}
+
+func TestSentinel_Clock(t *testing.T) {
+	sentinel, err := NewSentinel()
+	if err != nil {
+		t.Fatalf("Failed to create sentinel: %v", err)
+	}
+	if err := sentinel.AddEndpoint("GET /reports", "allow: hour(now(), 'Asia/Shanghai') >= 9 and hour(now(), 'Asia/Shanghai') < 18 and now() < date('2026-12-31')"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+	if err := sentinel.AddEndpoint("GET /tokens", "allow: now() - #issuedAt < duration('24h')"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+
+	at := func(value string) func() time.Time {
+		return func() time.Time {
+			v, _ := time.Parse(time.RFC3339, value)
+			return v
+		}
+	}
+	issuedAt := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		endpoint string
+		opts     CheckOptions
+		expected bool
+	}{
+		{"GET /reports", CheckOptions{Clock: at("2026-10-16T10:00:00+08:00")}, true},
+		{"GET /reports", CheckOptions{Clock: at("2026-10-16T20:00:00+08:00")}, false},
+		{"GET /reports", CheckOptions{Clock: at("2027-01-04T10:00:00+08:00")}, false},
+		{"GET /tokens", CheckOptions{Clock: at("2026-10-16T23:59:59Z"), CustomParams: map[string]any{"issuedAt": issuedAt}}, true},
+		{"GET /tokens", CheckOptions{Clock: at("2026-10-17T00:00:00Z"), CustomParams: map[string]any{"issuedAt": issuedAt}}, false},
+	}
+	for _, tc := range testCases {
+		result, err := sentinel.CheckWith(tc.endpoint, nil, tc.opts)
+		if err != nil {
+			t.Errorf("Unexpected error for endpoint %s: %v", tc.endpoint, err)
+			continue
+		}
+		if result != tc.expected {
+			t.Errorf("Endpoint %s at %v: expected %v, got %v", tc.endpoint, tc.opts.Clock(), tc.expected, result)
+		}
+	}
+}
+
 func TestSentinel_CleanEndpoints(t *testing.T) {
 	sentinel, err := NewSentinel()
 	if err != nil {
@@ -640,6 +885,602 @@ func TestSentinel_CleanEndpoints(t *testing.T) {
 	}
 }
 
+func TestSentinel_Replace(t *testing.T) {
+	sentinel, err := NewSentinel()
+	if err != nil {
+		t.Fatalf("Failed to create sentinel: %v", err)
+	}
+
+	err = sentinel.AddEndpoint("GET /api/users", "allow: Role('admin')")
+	if err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+
+	principal := &sentinelTestPrincipal{roles: []string{"user"}}
+
+	// Replace with new rules
+	err = sentinel.Replace([]Rule{
+		{Endpoint: "GET /api/users", Express: "allow: Role('user')"},
+		{Endpoint: "GET /api/orders", Express: "allow: Role('user')"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to replace rules: %v", err)
+	}
+
+	for _, endpoint := range []string{"GET /api/users", "GET /api/orders"} {
+		result, err := sentinel.Check(endpoint, principal, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error for endpoint %s: %v", endpoint, err)
+		}
+		if !result {
+			t.Errorf("Endpoint %s: expected true after replace", endpoint)
+		}
+	}
+
+	// Invalid rule set keeps the current rules
+	err = sentinel.Replace([]Rule{
+		{Endpoint: "GET /api/users", Express: "allow: Role('admin')"},
+		{Endpoint: "GET /api/broken", Express: "Role('admin')"},
+	})
+	if err == nil {
+		t.Fatal("Expected error for invalid rule set")
+	}
+
+	result, err := sentinel.Check("GET /api/orders", principal, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result {
+		t.Error("Expected previous rules to stay active after failed replace")
+	}
+
+	// Failed AddEndpoint keeps the current rules too
+	err = sentinel.AddEndpoint("GET /api/users", "allow: Role('admin')")
+	if err == nil {
+		t.Fatal("Expected error for duplicate endpoint")
+	}
+	result, err = sentinel.Check("GET /api/users", principal, nil)
+	if err != nil || !result {
+		t.Errorf("Expected rules unchanged after failed add, got %v, %v", result, err)
+	}
+}
+
+func TestSentinel_RegisterFunction(t *testing.T) {
+	hasLicense := func(context *SecurityContext, args []any) (any, error) {
+		return context.CustomParams["license"] == args[0], nil
+	}
+	ownsOrder := func(context *SecurityContext, args []any) (any, error) {
+		return context.Principal.Id() == "alice" && args[0] == "1001", nil
+	}
+
+	sentinel, err := NewSentinel(
+		WithFunction("HasLicense", Signature{Args: []ValueType{TypeString}, Return: TypeBool}, hasLicense),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create sentinel: %v", err)
+	}
+
+	// Function registered by option
+	if err := sentinel.AddEndpoint("GET /api/reports", "allow: HasLicense('pro')"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+
+	// Function not registered yet
+	if err := sentinel.AddEndpoint("GET /api/orders/:id", "allow: OwnsOrder($id)"); err == nil {
+		t.Fatal("Expected error for unregistered function")
+	}
+
+	if err := sentinel.RegisterFunction("OwnsOrder", Signature{Args: []ValueType{TypeString}, Return: TypeBool}, ownsOrder); err != nil {
+		t.Fatalf("Failed to register function: %v", err)
+	}
+	if err := sentinel.RegisterFunction("OwnsOrder", Signature{Args: []ValueType{TypeString}, Return: TypeBool}, ownsOrder); err == nil {
+		t.Error("Expected error for duplicate function")
+	}
+	if err := sentinel.AddEndpoint("GET /api/orders/:id", "allow: OwnsOrder($id)"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+
+	// Functions are not shared with other sentinels or guards
+	if _, err := NewGuard("allow: HasLicense('pro')"); err == nil {
+		t.Error("Expected error for function registered on another sentinel")
+	}
+
+	alice := &sentinelTestPrincipal{id: "alice"}
+	testCases := []struct {
+		endpoint string
+		custom   map[string]string
+		expected bool
+	}{
+		{"GET /api/reports", map[string]string{"license": "pro"}, true},
+		{"GET /api/reports", map[string]string{"license": "free"}, false},
+		{"GET /api/orders/1001", nil, true},
+		{"GET /api/orders/1002", nil, false},
+	}
+	for _, tc := range testCases {
+		result, err := sentinel.Check(tc.endpoint, alice, tc.custom)
+		if err != nil {
+			t.Errorf("Unexpected error for endpoint %s: %v", tc.endpoint, err)
+			continue
+		}
+		if result != tc.expected {
+			t.Errorf("Endpoint %s: expected %v, got %v", tc.endpoint, tc.expected, result)
+		}
+	}
+
+	// Replace keeps registered functions
+	err = sentinel.Replace([]Rule{
+		{Endpoint: "GET /api/reports", Express: "allow: HasLicense('enterprise') or OwnsOrder('1001')"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to replace rules: %v", err)
+	}
+}
+
+func TestSentinel_WildcardPermission(t *testing.T) {
+	sentinel, err := NewSentinel(WithWildcardPermission())
+	if err != nil {
+		t.Fatalf("Failed to create sentinel: %v", err)
+	}
+
+	if err := sentinel.AddEndpoint("GET /api/orders/:id", "allow: Permission('orders:read')"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+	if err := sentinel.AddEndpoint("DELETE /api/orders/:id", "allow: Permission('orders:delete')"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+	if err := sentinel.AddEndpoint("GET /api/docs/:id", "allow: Permission('docs::read')"); err == nil {
+		t.Error("Expected error for invalid permission")
+	}
+
+	// Functions registered later keep wildcard matching
+	isTrue := func(_ *SecurityContext, args []any) (any, error) { return args[0], nil }
+	if err := sentinel.RegisterFunction("IsTrue", Signature{Args: []ValueType{TypeBool}, Return: TypeBool}, isTrue); err != nil {
+		t.Fatalf("Failed to register function: %v", err)
+	}
+	if err := sentinel.AddEndpoint("GET /api/docs/:id", "allow: IsTrue(true) and Permission('docs:read:' )"); err == nil {
+		t.Error("Expected error for invalid permission")
+	}
+	if err := sentinel.AddEndpoint("GET /api/docs/:id", "allow: IsTrue(true) and Permission('docs:read')"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+
+	reader := &sentinelTestPrincipal{id: "alice", permissions: []string{"orders:read,list", "docs:*"}}
+	testCases := []struct {
+		endpoint string
+		expected bool
+	}{
+		{"GET /api/orders/1001", true},
+		{"DELETE /api/orders/1001", false},
+		{"GET /api/docs/1", true},
+	}
+	for _, tc := range testCases {
+		result, err := sentinel.Check(tc.endpoint, reader, nil)
+		if err != nil {
+			t.Errorf("Unexpected error for endpoint %s: %v", tc.endpoint, err)
+			continue
+		}
+		if result != tc.expected {
+			t.Errorf("Endpoint %s: expected %v, got %v", tc.endpoint, tc.expected, result)
+		}
+	}
+}
+
+func TestSentinel_RoleHierarchy(t *testing.T) {
+	hierarchy, err := ParseRoleHierarchy("admin > manager > user")
+	if err != nil {
+		t.Fatalf("Failed to parse role hierarchy: %v", err)
+	}
+	sentinel, err := NewSentinel(WithRoleHierarchy(hierarchy))
+	if err != nil {
+		t.Fatalf("Failed to create sentinel: %v", err)
+	}
+
+	if err := sentinel.AddEndpoint("GET /api/users", "allow: Role('user')"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+	if err := sentinel.AddEndpoint("DELETE /api/users/:id", "allow: Roles('admin')"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+
+	manager := &sentinelTestPrincipal{id: "bob", roles: []string{"manager"}}
+	testCases := []struct {
+		endpoint string
+		expected bool
+	}{
+		{"GET /api/users", true},
+		{"DELETE /api/users/1", false},
+	}
+	for _, tc := range testCases {
+		result, err := sentinel.Check(tc.endpoint, manager, nil)
+		if err != nil {
+			t.Errorf("Unexpected error for endpoint %s: %v", tc.endpoint, err)
+			continue
+		}
+		if result != tc.expected {
+			t.Errorf("Endpoint %s: expected %v, got %v", tc.endpoint, tc.expected, result)
+		}
+	}
+}
+
+func TestSentinel_Decimal(t *testing.T) {
+	sentinel, err := NewSentinel(WithDecimal())
+	if err != nil {
+		t.Fatalf("Failed to create sentinel: %v", err)
+	}
+	if err := sentinel.AddEndpoint("GET /api/pay/:amount", "allow: $amount + 0.2 == 0.3"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+	if err := sentinel.AddEndpoint("GET /api/split/:amount", "allow: $amount / 0 > 1"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+
+	result, err := sentinel.Check("GET /api/pay/0.1", nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result {
+		t.Error("Expected 0.1 + 0.2 == 0.3 in decimal mode")
+	}
+	if _, err := sentinel.Check("GET /api/split/10", nil, nil); !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("Expected ErrDivisionByZero, got %v", err)
+	}
+}
+
+func TestSentinel_MissingParams(t *testing.T) {
+	sentinel, err := NewSentinel(WithMissingParamError())
+	if err != nil {
+		t.Fatalf("Failed to create sentinel: %v", err)
+	}
+	if err := sentinel.AddEndpoint("GET /books", "allow: $query.page ?? 1 == 1"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+	if err := sentinel.AddEndpoint("GET /docs", "allow: exists($query.draft) or $query.lang == 'en'"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+
+	testCases := []struct {
+		endpoint string
+		expected bool
+		err      error
+	}{
+		{"GET /books", true, nil},
+		{"GET /books?page=2", false, nil},
+		{"GET /docs?draft=", true, nil},
+		{"GET /docs?lang=en", true, nil},
+		{"GET /docs", false, ErrMissingParam},
+	}
+	for _, tc := range testCases {
+		result, err := sentinel.Check(tc.endpoint, nil, nil)
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) {
+				t.Errorf("Endpoint %s: expected error %v, got %v", tc.endpoint, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for endpoint %s: %v", tc.endpoint, err)
+			continue
+		}
+		if result != tc.expected {
+			t.Errorf("Endpoint %s: expected %v, got %v", tc.endpoint, tc.expected, result)
+		}
+	}
+}
+
+func TestSentinel_MultiValuedParams(t *testing.T) {
+	sentinel, err := NewSentinel()
+	if err != nil {
+		t.Fatalf("Failed to create sentinel: %v", err)
+	}
+	if err := sentinel.AddEndpoint("GET /posts?tag=:tag", "allow: any($tag, t -> t == 'public') and !contains($query.tag, 'secret')"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+	if err := sentinel.AddEndpoint("GET /docs", "deny: $query.tag == 'secret'"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+
+	testCases := []struct {
+		endpoint string
+		expected bool
+		hasError bool
+	}{
+		{"GET /posts?tag=public", true, false},
+		{"GET /posts?tag=draft", false, false},
+		{"GET /posts?tag=draft&tag=public", true, false},
+		{"GET /posts?tag=public&tag=secret", false, false},
+		{"GET /docs?tag=secret", false, false},
+		// 重复参数不能直接比较，避免 ?tag=public&tag=secret 绕过规则
+		{"GET /docs?tag=public&tag=secret", false, true},
+	}
+	for _, tc := range testCases {
+		result, err := sentinel.Check(tc.endpoint, nil, nil)
+		if tc.hasError {
+			if err == nil {
+				t.Errorf("Expected error for endpoint %s", tc.endpoint)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for endpoint %s: %v", tc.endpoint, err)
+			continue
+		}
+		if result != tc.expected {
+			t.Errorf("Endpoint %s: expected %v, got %v", tc.endpoint, tc.expected, result)
+		}
+	}
+}
+
+func TestSentinel_UndefinedParams(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		express  string
+		// 未定义的参数，为空表示创建成功
+		undefined []string
+	}{
+		{"GET /users/:userId", "allow: $userId == '1' and $path.userId == '1'", nil},
+		{"GET /users/:userId", "allow: $usrId == '1'", []string{"$usrId"}},
+		{"GET /users/:userId", "allow: $path.usrId == '1' or $wildcard.0 == 'a'", []string{"$path.usrId", "$wildcard.0"}},
+		{"/files/*/raw/*", "allow: $0 == 'a' and $wildcard.1 == 'b'", nil},
+		{"/files/*", "allow: $1 == 'a'", []string{"$1"}},
+		{"GET /books?category=:category&q=:query", "allow: $category == 'a' and $q == $query and $query.category == 'a'", nil},
+		// 未声明的查询参数需要通过 $query 访问
+		{"GET /books", "allow: $query.page == '1'", nil},
+		{"GET /books", "allow: $page == '1'", []string{"$page"}},
+		// # 参数由调用方提供，不检查
+		{"GET /books", "allow: #tenant == 'a'", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint+" "+tt.express, func(t *testing.T) {
+			sentinel, _ := NewSentinel()
+			err := sentinel.AddEndpoint(tt.endpoint, tt.express)
+			if len(tt.undefined) == 0 {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			var errs ParseErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Expected ParseErrors, got %v", err)
+			}
+			if len(errs) != len(tt.undefined) {
+				t.Fatalf("Expected %d errors, got %v", len(tt.undefined), err)
+			}
+			for i, e := range errs {
+				if e.Code != CodeUndefinedParam || e.Token != tt.undefined[i] {
+					t.Errorf("Expected undefined %s, got %s %s", tt.undefined[i], e.Code, e.Token)
+				}
+			}
+		})
+	}
+}
+
+func TestSentinel_WarningHandler(t *testing.T) {
+	type warning struct {
+		endpoint string
+		tokens   []string
+	}
+	var got []warning
+	sentinel, err := NewSentinel(WithWarningHandler(func(endpoint string, warnings []*ParseError) {
+		w := warning{endpoint: endpoint}
+		for _, e := range warnings {
+			if e.Code != CodeIncomparableTypes {
+				t.Errorf("Expected %s, got %s", CodeIncomparableTypes, e.Code)
+			}
+			w.tokens = append(w.tokens, e.Token)
+		}
+		got = append(got, w)
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create sentinel: %v", err)
+	}
+
+	if err := sentinel.AddEndpoint("GET/POST /users/:id", "allow: $id > 'abc'"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+	if err := sentinel.AddEndpoint("GET /books", "allow: Role('admin')"); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+	// 替换失败时不报告警告
+	if err := sentinel.Replace([]Rule{
+		{Endpoint: "GET /a", Express: "allow: Role('x') == null"},
+		{Endpoint: "GET /b", Express: "allow: $x == 1"},
+	}); err == nil {
+		t.Fatal("Expected replace to fail")
+	}
+	if err := sentinel.Replace([]Rule{
+		{Endpoint: "GET /a", Express: "allow: Role('x') == null"},
+		{Endpoint: "GET /b", Express: "allow: true"},
+	}); err != nil {
+		t.Fatalf("Failed to replace rules: %v", err)
+	}
+
+	expected := []warning{
+		{endpoint: "GET/POST /users/:id", tokens: []string{"$id > 'abc'"}},
+		{endpoint: "GET /a", tokens: []string{"Role('x') == null"}},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected warnings %+v, got %+v", expected, got)
+	}
+}
+
+func TestSentinel_ConcurrentReplace(t *testing.T) {
+	sentinel, err := NewSentinel()
+	if err != nil {
+		t.Fatalf("Failed to create sentinel: %v", err)
+	}
+
+	rules := []Rule{
+		{Endpoint: "GET /api/users", Express: "allow: Role('user')"},
+		{Endpoint: "GET /api/users/:id", Express: "allow: Role('user') or $id == 'self'"},
+	}
+	if err := sentinel.Replace(rules); err != nil {
+		t.Fatalf("Failed to replace rules: %v", err)
+	}
+
+	principal := &sentinelTestPrincipal{roles: []string{"user"}}
+	done := make(chan struct{})
+	errs := make(chan error, 4)
+
+	for range 4 {
+		go func() {
+			for {
+				select {
+				case <-done:
+					errs <- nil
+					return
+				default:
+				}
+				result, err := sentinel.Check("GET /api/users/123", principal, nil)
+				if err != nil || !result {
+					errs <- fmt.Errorf("unexpected result during reload: %v, %v", result, err)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := range 200 {
+		if err := sentinel.Replace(rules); err != nil {
+			t.Fatalf("Failed to replace rules: %v", err)
+		}
+		sentinel.AddEndpoint(fmt.Sprintf("GET /api/extra%d", i), "allow: Role('user')")
+	}
+	close(done)
+
+	for range 4 {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSentinel_DefaultPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   []SentinelOption
+		endpoint  string
+		expected  bool
+		wantError bool
+	}{
+		{
+			name:      "Default error policy - route not found",
+			endpoint:  "GET /api/nonexistent",
+			wantError: true,
+		},
+		{
+			name:      "Lower case method rule matches",
+			endpoint:  "GET /api/lower",
+			wantError: false,
+			expected:  true,
+		},
+		{
+			name:     "Allow policy - route not found",
+			options:  []SentinelOption{WithDefaultPolicy(DefaultAllow)},
+			endpoint: "GET /api/nonexistent",
+			expected: true,
+		},
+		{
+			name:     "Deny policy - route not found",
+			options:  []SentinelOption{WithDefaultPolicy(DefaultDeny)},
+			endpoint: "PUT /api/users",
+			expected: false,
+		},
+		{
+			name: "Unmatched handler overrides default policy",
+			options: []SentinelOption{
+				WithDefaultPolicy(DefaultAllow),
+				WithUnmatchedHandler(func(endpoint string, principal SecurityPrincipal) (bool, error) {
+					return false, fmt.Errorf("unprotected endpoint: %s", endpoint)
+				}),
+			},
+			endpoint:  "GET /api/nonexistent",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sentinel, err := NewSentinel(tt.options...)
+			if err != nil {
+				t.Fatalf("Failed to create sentinel: %v", err)
+			}
+			if err := sentinel.AddEndpoint("GET /api/users", "allow: Role('admin')"); err != nil {
+				t.Fatalf("Failed to add endpoint: %v", err)
+			}
+			// lower case method must resolve to the same guard as the router
+			if err := sentinel.AddEndpoint("get /api/lower", "allow: Role('admin')"); err != nil {
+				t.Fatalf("Failed to add endpoint: %v", err)
+			}
+
+			principal := &sentinelTestPrincipal{roles: []string{"admin"}}
+			result, err := sentinel.Check(tt.endpoint, principal, nil)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("Expected error for endpoint %s but got none", tt.endpoint)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error for endpoint %s: %v", tt.endpoint, err)
+			}
+			if result != tt.expected {
+				t.Errorf("Endpoint %s: expected %v, got %v", tt.endpoint, tt.expected, result)
+			}
+		})
+	}
+
+	if _, err := NewSentinel(WithDefaultPolicy("maybe")); err == nil {
+		t.Error("Expected error for invalid default policy")
+	}
+}
+
+func TestSentinel_Decide(t *testing.T) {
+	sentinel, err := NewSentinel(WithDefaultPolicy(DefaultDeny))
+	if err != nil {
+		t.Fatalf("Failed to create sentinel: %v", err)
+	}
+
+	express := "allow: Role('admin') or $userId == 'self'"
+	if err := sentinel.AddEndpoint("GET/PUT /api/users/:userId", express); err != nil {
+		t.Fatalf("Failed to add endpoint: %v", err)
+	}
+
+	principal := &sentinelTestPrincipal{roles: []string{"user"}}
+
+	decision, err := sentinel.Decide("PUT /api/users/self?userId=123", principal, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !decision.Allowed || !decision.Matched {
+		t.Errorf("Expected matched and allowed decision, got %+v", decision)
+	}
+	if decision.Method != "PUT" || decision.Pattern != "/api/users/:userId" {
+		t.Errorf("Unexpected endpoint in decision: %s %s", decision.Method, decision.Pattern)
+	}
+	if decision.Policy != "allow" || decision.Express != express {
+		t.Errorf("Unexpected policy / express in decision: %s / %s", decision.Policy, decision.Express)
+	}
+	expectedParams := []DecisionParam{
+		{Source: "path", Name: "userId", Value: "self"},
+		{Source: "query", Name: "userId", Value: "123"},
+	}
+	if fmt.Sprint(decision.Params) != fmt.Sprint(expectedParams) {
+		t.Errorf("Expected params %v, got %v", expectedParams, decision.Params)
+	}
+
+	// Unmatched endpoint follows the default policy
+	decision, err = sentinel.StrictDecide("DELETE /api/users/self", principal, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if decision.Allowed || decision.Matched || decision.Policy != string(DefaultDeny) {
+		t.Errorf("Expected unmatched deny decision, got %+v", decision)
+	}
+}
+
 func TestSentinel_WithConfig(t *testing.T) {
 	// Create a temporary config file
 	configContent := `# Test configuration
@@ -729,6 +1570,58 @@ GET/POST /api/files/*, allow: Role('filemanager')`
 	}
 }
 
+// 放在 WithConfig 之后的选项同样对配置文件中的规则生效
+func TestSentinel_WithConfigOptionOrder(t *testing.T) {
+	configContent := `GET /api/orders/:id, allow: Permission('orders:read:' + $id)
+GET /api/reports, allow: Role('user')
+GET /api/prices, allow: 0.1 + 0.2 == 0.3
+GET /api/strict/:id, allow: $id == 1
+GET /api/licensed, allow: HasLicense('pro')`
+
+	tmpFile, err := os.CreateTemp("", "test_rules_*.txt")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err = tmpFile.WriteString(configContent); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	tmpFile.Close()
+
+	hierarchy, err := ParseRoleHierarchy("admin > user")
+	if err != nil {
+		t.Fatalf("Failed to parse role hierarchy: %v", err)
+	}
+	hasLicense := func(context *SecurityContext, args []any) (any, error) {
+		return args[0] == "pro", nil
+	}
+	sentinel, err := NewSentinel(
+		WithConfig(tmpFile.Name()),
+		WithWildcardPermission(),
+		WithRoleHierarchy(hierarchy),
+		WithDecimal(),
+		WithStrictTypes(),
+		WithFunction("HasLicense", Signature{Args: []ValueType{TypeString}, Return: TypeBool}, hasLicense),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create sentinel: %v", err)
+	}
+
+	principal := &sentinelTestPrincipal{roles: []string{"admin"}, permissions: []string{"orders:*"}}
+	for _, endpoint := range []string{"GET /api/orders/1001", "GET /api/reports", "GET /api/prices", "GET /api/licensed"} {
+		result, err := sentinel.Check(endpoint, principal, nil)
+		if err != nil || !result {
+			t.Errorf("%s: expected true, got %v, %v", endpoint, result, err)
+		}
+	}
+	if _, err := sentinel.Check("GET /api/orders/1:read", principal, nil); err == nil {
+		t.Error("Expected error for reserved characters in wildcard permission")
+	}
+	if _, err := sentinel.Check("GET /api/strict/1", principal, nil); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v", err)
+	}
+}
+
 func TestSentinel_EdgeCases(t *testing.T) {
 	tests := []struct {
 		name      string